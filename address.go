@@ -0,0 +1,146 @@
+package kubepods
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+
+	core "k8s.io/api/core/v1"
+)
+
+// AddressSource provides the addresses of a Pod that records are created for, and that identify
+// the Pod as a client for metadata and autopath.
+type AddressSource interface {
+	// Addresses returns the addresses of pod, in their canonical text form.
+	Addresses(pod *core.Pod) []string
+}
+
+// AddressSourceFunc is an AddressSource implemented by a function.
+type AddressSourceFunc func(pod *core.Pod) []string
+
+// Addresses implements the AddressSource interface.
+func (f AddressSourceFunc) Addresses(pod *core.Pod) []string { return f(pod) }
+
+// NewAddressSource returns an AddressSource configured with the arguments of the addresses
+// directive that follow the source's name.
+type NewAddressSource func(args []string) (AddressSource, error)
+
+var (
+	addressSourcesLock sync.RWMutex
+	addressSources     = make(map[string]NewAddressSource)
+)
+
+// RegisterAddressSource registers an address source under name, which selects it in the
+// addresses directive. Packages that embed kubepods can register their own sources from an init
+// function. Registering a name twice panics.
+func RegisterAddressSource(name string, source NewAddressSource) {
+	addressSourcesLock.Lock()
+	defer addressSourcesLock.Unlock()
+	if _, ok := addressSources[name]; ok {
+		panic(fmt.Sprintf("address source %q registered twice", name))
+	}
+	addressSources[name] = source
+}
+
+// newAddressSource returns the registered address source name configured with args.
+func newAddressSource(name string, args []string) (AddressSource, error) {
+	addressSourcesLock.RLock()
+	source, ok := addressSources[name]
+	addressSourcesLock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown address source '%s', registered are: %s", name, strings.Join(addressSourceNames(), ", "))
+	}
+	return source(args)
+}
+
+// addressSourceNames returns the names of the registered address sources.
+func addressSourceNames() []string {
+	addressSourcesLock.RLock()
+	defer addressSourcesLock.RUnlock()
+	names := make([]string, 0, len(addressSources))
+	for name := range addressSources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// defaultAddressSource is the address source used when there is no addresses directive.
+var defaultAddressSource AddressSource = AddressSourceFunc(podIPs)
+
+func init() {
+	RegisterAddressSource("pod_ips", noArgs(podIPs))
+	RegisterAddressSource("pod_ip", noArgs(podIP))
+	RegisterAddressSource("host_ip", noArgs(hostIP))
+	RegisterAddressSource("annotation", func(args []string) (AddressSource, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("address source annotation needs the name of the annotation")
+		}
+		key := args[0]
+		return AddressSourceFunc(func(pod *core.Pod) []string {
+			return annotationIPs(pod, key)
+		}), nil
+	})
+}
+
+// noArgs returns a NewAddressSource for an address source without arguments.
+func noArgs(f AddressSourceFunc) NewAddressSource {
+	return func(args []string) (AddressSource, error) {
+		if len(args) != 0 {
+			return nil, fmt.Errorf("unexpected arguments %v", args)
+		}
+		return f, nil
+	}
+}
+
+// podIPs returns the addresses in status.podIPs.
+func podIPs(pod *core.Pod) (ips []string) {
+	for _, ip := range pod.Status.PodIPs {
+		ips = append(ips, ip.IP)
+	}
+	return ips
+}
+
+// podIP returns the addresses in status.podIPs, or the address in status.podIP for clusters
+// that don't set status.podIPs.
+func podIP(pod *core.Pod) []string {
+	if len(pod.Status.PodIPs) > 0 {
+		return podIPs(pod)
+	}
+	if pod.Status.PodIP == "" {
+		return nil
+	}
+	return []string{pod.Status.PodIP}
+}
+
+// hostIP returns the address in status.hostIP for Pods on the host network, and the addresses in
+// status.podIPs for other Pods.
+func hostIP(pod *core.Pod) []string {
+	if !pod.Spec.HostNetwork {
+		return podIPs(pod)
+	}
+	if pod.Status.HostIP == "" {
+		return nil
+	}
+	return []string{pod.Status.HostIP}
+}
+
+// annotationIPs returns the comma separated addresses in the annotation key. Invalid addresses
+// are dropped.
+func annotationIPs(pod *core.Pod, key string) (ips []string) {
+	value, ok := pod.Annotations[key]
+	if !ok {
+		return nil
+	}
+	for _, s := range strings.Split(value, ",") {
+		ip := net.ParseIP(strings.TrimSpace(s))
+		if ip == nil {
+			log.Debugf("Invalid address %q in annotation %q of Pod %s/%s", s, key, pod.Namespace, pod.Name)
+			continue
+		}
+		ips = append(ips, ip.String())
+	}
+	return ips
+}
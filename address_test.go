@@ -0,0 +1,90 @@
+package kubepods
+
+import (
+	"reflect"
+	"testing"
+
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestAddressSources(t *testing.T) {
+	pod := &core.Pod{
+		ObjectMeta: meta.ObjectMeta{
+			Name:        "pod1",
+			Namespace:   "namespace1",
+			Annotations: map[string]string{"example.com/ips": "192.168.0.1, invalid,fd00:0::1"},
+		},
+		Status: core.PodStatus{
+			HostIP: "172.16.0.1",
+			PodIP:  "10.0.0.1",
+			PodIPs: []core.PodIP{{IP: "10.0.0.1"}, {IP: "fd00::1"}},
+		},
+	}
+	legacy := pod.DeepCopy()
+	legacy.Status.PodIPs = nil
+	host := pod.DeepCopy()
+	host.Spec.HostNetwork = true
+
+	tests := []struct {
+		source string
+		args   []string
+		pod    *core.Pod
+		expect []string
+	}{
+		{"pod_ips", nil, pod, []string{"10.0.0.1", "fd00::1"}},
+		{"pod_ips", nil, legacy, nil},
+		{"pod_ip", nil, pod, []string{"10.0.0.1", "fd00::1"}},
+		{"pod_ip", nil, legacy, []string{"10.0.0.1"}},
+		{"host_ip", nil, pod, []string{"10.0.0.1", "fd00::1"}},
+		{"host_ip", nil, host, []string{"172.16.0.1"}},
+		{"annotation", []string{"example.com/ips"}, pod, []string{"192.168.0.1", "fd00::1"}},
+		{"annotation", []string{"example.com/other"}, pod, nil},
+	}
+	for i, tc := range tests {
+		source, err := newAddressSource(tc.source, tc.args)
+		if err != nil {
+			t.Fatalf("Test %d: unexpected error: %v", i, err)
+		}
+		if ips := source.Addresses(tc.pod); !reflect.DeepEqual(ips, tc.expect) {
+			t.Errorf("Test %d: expected %v from %s, got %v", i, tc.expect, tc.source, ips)
+		}
+	}
+
+	if _, err := newAddressSource("pod_ips", []string{"extra"}); err == nil {
+		t.Error("Expected error for pod_ips with arguments")
+	}
+	if _, err := newAddressSource("annotation", nil); err == nil {
+		t.Error("Expected error for annotation without name")
+	}
+	if _, err := newAddressSource("unknown", nil); err == nil {
+		t.Error("Expected error for unknown source")
+	}
+}
+
+func TestRegisterAddressSource(t *testing.T) {
+	RegisterAddressSource("test_fixed", func(args []string) (AddressSource, error) {
+		return AddressSourceFunc(func(pod *core.Pod) []string { return args }), nil
+	})
+
+	k := New([]string{"cluster.local."})
+	var err error
+	k.addresses, err = newAddressSource("test_fixed", []string{"10.9.9.9"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	obj, err := k.toPodRecord(&core.Pod{ObjectMeta: meta.ObjectMeta{Name: "pod1", Namespace: "namespace1"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if ips := obj.(*podRecord).IPs; !reflect.DeepEqual(ips, []string{"10.9.9.9"}) {
+		t.Errorf("Expected the addresses of the registered source, got %v", ips)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected panic when registering a source twice")
+		}
+	}()
+	RegisterAddressSource("test_fixed", nil)
+}
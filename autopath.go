@@ -1,8 +1,6 @@
 package kubepods
 
 import (
-	core "k8s.io/api/core/v1"
-
 	"github.com/coredns/coredns/plugin"
 	"github.com/coredns/coredns/request"
 )
@@ -14,21 +12,15 @@ func (k *KubePods) AutoPath(state request.Request) []string {
 		return nil
 	}
 
-	if k.mode == modeEchoIP {
+	if k.zoneMode(zone) == modeEchoIP {
 		return nil
 	}
 
 	ip := state.IP()
 
-	obj, err := k.indexer.ByIndex("reverse", ip)
-	if err != nil {
-		return nil
-	}
-	if len(obj) == 0 {
-		return nil
-	}
-	pod, ok := obj[0].(*core.Pod)
-	if !ok {
+	pod, err := k.podByIP(ip)
+	autopathLookups.WithLabelValues(lookupResult(err == nil && pod != nil)).Inc()
+	if err != nil || pod == nil {
 		return nil
 	}
 
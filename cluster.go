@@ -0,0 +1,137 @@
+package kubepods
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin/metrics"
+	"github.com/coredns/coredns/plugin/pkg/dnsutil"
+	"github.com/coredns/coredns/request"
+	"github.com/coredns/kubeapi"
+)
+
+// cluster is a Kubernetes cluster whose Pods are answered in the subzone named after it. Its
+// KubePods answers the queries for the subzone with the Pods of the cluster.
+type cluster struct {
+	name       string
+	kubeconfig string // empty to connect with the kubeapi plugin
+	context    string // empty for the current context of kubeconfig
+	*KubePods
+}
+
+// newCluster returns a cluster with the same configuration as k, for the subzones named name.
+func (k *KubePods) newCluster(name, kubeconfig, context string) *cluster {
+	var zones []string
+	for _, z := range k.Zones {
+		if !isReverseZone(z) {
+			zones = append(zones, dnsutil.Join(name, z))
+		}
+	}
+
+	c := New(zones)
+	for z, mode := range k.zoneModes {
+		c.zoneModes[dnsutil.Join(name, z)] = mode
+	}
+	c.Fall = k.Fall
+	c.ttl = k.ttl
+	c.mode = k.mode
+	c.serve = k.serve
+	c.template = k.template
+	c.addresses = k.addresses
+	c.ownerRecords = k.ownerRecords
+	c.labelKeys = k.labelKeys
+	c.namespaceRecords = k.namespaceRecords
+	if k.ptrZone != "" {
+		c.ptrZone = dnsutil.Join(name, k.ptrZone)
+	}
+	c.ptrCanonical = k.ptrCanonical
+	c.autoPathSearch = k.autoPathSearch
+	c.namespaces = k.namespaces
+	c.ignoreNamespaces = k.ignoreNamespaces
+	c.labelSelector = k.labelSelector
+	c.namespaced = k.namespaced
+	c.node = k.node
+	c.unsynced = k.unsynced
+	c.unsyncedTimeout = k.unsyncedTimeout
+	c.stalePolicy = k.stalePolicy
+	c.staleThreshold = k.staleThreshold
+	c.staleTTL = k.staleTTL
+	if k.snapshotFile != "" {
+		c.snapshotFile = k.snapshotFile + "." + name
+		c.snapshotInterval = k.snapshotInterval
+	}
+	return &cluster{name: name, kubeconfig: kubeconfig, context: context, KubePods: c}
+}
+
+// connect returns a client for the cluster's Kubernetes API.
+func (c *cluster) connect(config *dnsserver.Config) (kubernetes.Interface, error) {
+	if c.kubeconfig == "" {
+		return kubeapi.Client(config)
+	}
+	rules := &clientcmd.ClientConfigLoadingRules{ExplicitPath: c.kubeconfig}
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: c.context}
+	cc, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides).ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	return kubernetes.NewForConfig(cc)
+}
+
+// sources returns the KubePods that hold the Pods: those of the clusters, or k itself.
+func (k *KubePods) sources() []*KubePods {
+	if len(k.clusters) == 0 {
+		return []*KubePods{k}
+	}
+	sources := make([]*KubePods, len(k.clusters))
+	for i, c := range k.clusters {
+		sources[i] = c.KubePods
+	}
+	return sources
+}
+
+// serveClusters answers queries when there are clusters. Queries for names in a cluster's
+// subzone are answered by the cluster, reverse lookups by all clusters, subject to the unsynced
+// and stale policies of each of them.
+func (k *KubePods) serveClusters(ctx context.Context, state request.Request) (rcode int, err error) {
+	qname := state.Name()
+	if len(state.Zone) == len(qname) || qname == nsName(state.Zone) {
+		start := time.Now()
+		defer func() { reportRequest(metrics.WithServer(ctx), state.QType(), rcode, pathApex, start) }()
+		return k.serveApex(state)
+	}
+	if isReverseZone(qname) {
+		start := time.Now()
+		path := pathPTR
+		defer func() { reportRequest(metrics.WithServer(ctx), state.QType(), rcode, path, start) }()
+		// the records come from all clusters, so the policies apply to each of them
+		for _, c := range k.clusters {
+			if c.unsynced != unsyncedServe && !c.hasSynced() {
+				if rcode, done, err := c.serveUnsynced(ctx, state); done {
+					path = pathUnsynced
+					return rcode, err
+				}
+			}
+			if c.stalePolicy == staleFail && c.watchFailing() {
+				path = pathStale
+				return dns.RcodeServerFailure, nil
+			}
+		}
+		return k.serveReverse(ctx, state)
+	}
+
+	// the cluster is the label left of the zone
+	labels := dns.SplitDomainName(qname)
+	name := labels[len(labels)-dns.CountLabel(state.Zone)-1]
+	for _, c := range k.clusters {
+		if strings.EqualFold(c.name, name) {
+			return c.ServeDNS(ctx, state.W, state.Req)
+		}
+	}
+	return k.nxdomain(ctx, state)
+}
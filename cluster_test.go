@@ -0,0 +1,172 @@
+package kubepods
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+)
+
+func TestServeDNSClusters(t *testing.T) {
+	k := New([]string{"cluster.local.", "in-addr.arpa."})
+	k.mode = modeName
+	east := k.newCluster("east", "", "")
+	west := k.newCluster("west", "", "")
+	k.clusters = []*cluster{east, west}
+
+	ctx := context.Background()
+	east.client = fake.NewSimpleClientset()
+	addFixtures(ctx, east.KubePods)
+	west.client = fake.NewSimpleClientset()
+	// a Pod in another cluster with the address of pod2
+	west.client.CoreV1().Pods("namespace2").Create(ctx, &core.Pod{
+		ObjectMeta: meta.ObjectMeta{Name: "pod5", Namespace: "namespace2"},
+		Status:     core.PodStatus{PodIPs: []core.PodIP{{IP: "5.6.7.9"}}},
+	}, meta.CreateOptions{})
+
+	k.setWatch(ctx)
+	if k.Ready() {
+		t.Error("Expected not ready before the clusters have synced")
+	}
+	for _, c := range k.clusters {
+		go c.controller.Run(c.stopCh)
+		defer close(c.stopCh)
+	}
+	for _, c := range k.clusters {
+		for atomic.LoadInt32(&c.synced) == 0 {
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+	if !k.Ready() {
+		t.Error("Expected ready after the clusters have synced")
+	}
+
+	runTests(t, ctx, k, []test.Case{
+		{
+			Qname: "pod1.namespace1.east.cluster.local.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeSuccess,
+			Answer: []dns.RR{
+				test.A("pod1.namespace1.east.cluster.local.	5	IN	A	1.2.3.4"),
+				test.A("pod1.namespace1.east.cluster.local.	5	IN	A	5.6.7.8"),
+			},
+		},
+		{
+			Qname: "pod5.namespace2.WEST.cluster.local.", Qtype: dns.TypeA,
+			Rcode:  dns.RcodeSuccess,
+			Answer: []dns.RR{test.A("pod5.namespace2.west.cluster.local.	5	IN	A	5.6.7.9")},
+		},
+		{
+			Qname: "pod1.namespace1.west.cluster.local.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeNameError,
+			Ns:    []dns.RR{west.soa("west.cluster.local.")},
+		},
+		{
+			Qname: "east.cluster.local.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeSuccess,
+			Ns:    []dns.RR{east.soa("east.cluster.local.")},
+		},
+		{
+			Qname: "pod1.namespace1.north.cluster.local.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeNameError,
+			Ns:    []dns.RR{k.soa("cluster.local.")},
+		},
+		{
+			Qname: "pod1.namespace1.cluster.local.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeNameError,
+			Ns:    []dns.RR{k.soa("cluster.local.")},
+		},
+		{
+			Qname: "4.3.2.1.in-addr.arpa.", Qtype: dns.TypePTR,
+			Rcode:  dns.RcodeSuccess,
+			Answer: []dns.RR{test.PTR("4.3.2.1.in-addr.arpa.	5	IN	PTR	pod1.namespace1.east.cluster.local.")},
+		},
+		{
+			Qname: "9.7.6.5.in-addr.arpa.", Qtype: dns.TypePTR,
+			Rcode: dns.RcodeSuccess,
+			Answer: []dns.RR{
+				test.PTR("9.7.6.5.in-addr.arpa.	5	IN	PTR	pod2.namespace2.east.cluster.local."),
+				test.PTR("9.7.6.5.in-addr.arpa.	5	IN	PTR	pod5.namespace2.west.cluster.local."),
+			},
+		},
+	})
+
+	if pod, _ := k.podByIP("5.6.7.8"); pod == nil || pod.Name != "pod1" {
+		t.Errorf("Expected pod1 for client address, got %v", pod)
+	}
+
+	axfr := transferRecords(t, k, "west.cluster.local.", 0)
+	checkTransfer(t, axfr, []string{"pod5.namespace2.west.cluster.local.	5	IN	A	5.6.7.9"})
+	if _, err := k.Transfer("cluster.local.", 0); err == nil {
+		t.Error("Expected error for a transfer of the zone with clusters")
+	}
+
+	for _, qname := range []string{"cluster.local.", "ns.dns.cluster.local."} {
+		label := []string{"", "A", "NOERROR", pathApex}
+		before := testutil.ToFloat64(requestCount.WithLabelValues(label...))
+		r := new(dns.Msg)
+		r.SetQuestion(qname, dns.TypeA)
+		k.ServeDNS(ctx, dnstest.NewRecorder(&test.ResponseWriter{}), r)
+		if c := testutil.ToFloat64(requestCount.WithLabelValues(label...)); c != before+1 {
+			t.Errorf("Expected request for %s to be counted with labels %v", qname, label)
+		}
+	}
+}
+
+func TestServeDNSClustersReversePolicies(t *testing.T) {
+	k := New([]string{"cluster.local.", "in-addr.arpa."})
+	k.mode = modeName
+	k.unsynced = unsyncedServfail
+	k.stalePolicy = staleFail
+	k.staleThreshold = time.Minute
+	east := k.newCluster("east", "", "")
+	west := k.newCluster("west", "", "")
+	k.clusters = []*cluster{east, west}
+
+	ctx := context.Background()
+	east.client = fake.NewSimpleClientset()
+	addFixtures(ctx, east.KubePods)
+	west.client = fake.NewSimpleClientset()
+	k.setWatch(ctx)
+	go east.controller.Run(east.stopCh)
+	defer close(east.stopCh)
+	for atomic.LoadInt32(&east.synced) == 0 {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	query := func() int {
+		r := new(dns.Msg)
+		r.SetQuestion("4.3.2.1.in-addr.arpa.", dns.TypePTR)
+		w := dnstest.NewRecorder(&test.ResponseWriter{})
+		rcode, _ := k.ServeDNS(ctx, w, r)
+		return rcode
+	}
+
+	// west has not synced
+	if rcode := query(); rcode != dns.RcodeServerFailure {
+		t.Errorf("Expected SERVFAIL while a cluster is unsynced, got %d", rcode)
+	}
+
+	go west.controller.Run(west.stopCh)
+	defer close(west.stopCh)
+	for atomic.LoadInt32(&west.synced) == 0 {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if rcode := query(); rcode != dns.RcodeSuccess {
+		t.Errorf("Expected an answer once the clusters have synced, got %d", rcode)
+	}
+
+	// the watch of east has been failing for longer than the threshold
+	atomic.StoreInt64(&east.health[0].failing, time.Now().Add(-2*time.Minute).UnixNano())
+	if rcode := query(); rcode != dns.RcodeServerFailure {
+		t.Errorf("Expected SERVFAIL while the watch of a cluster is failing, got %d", rcode)
+	}
+}
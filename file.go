@@ -0,0 +1,201 @@
+package kubepods
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/cache"
+)
+
+// defaultFileReload is how often the Pod file is checked for changes.
+const defaultFileReload = 5 * time.Second
+
+// podFile is a Pod source that reads Pods from a file instead of the Kubernetes API.
+type podFile struct {
+	path     string
+	reload   time.Duration            // 0 to read the file only once
+	selected func(pod *core.Pod) bool // Pods that are not selected are dropped
+
+	lock    sync.Mutex
+	pods    map[string]*core.Pod // Pods by namespace/name, as last listed or watched
+	modTime time.Time
+	size    int64
+}
+
+// listWatch returns the ListWatch for the Pods in the file. The watch polls the file for changes
+// and sends the differences to the last read as events.
+func (f *podFile) listWatch() *cache.ListWatch {
+	return &cache.ListWatch{
+		ListFunc: func(o meta.ListOptions) (runtime.Object, error) {
+			f.lock.Lock()
+			defer f.lock.Unlock()
+			if err := f.read(); err != nil {
+				return nil, err
+			}
+			list := &core.PodList{}
+			for _, pod := range f.pods {
+				list.Items = append(list.Items, *pod)
+			}
+			return list, nil
+		},
+		WatchFunc: func(o meta.ListOptions) (watch.Interface, error) {
+			ch := make(chan watch.Event)
+			w := watch.NewProxyWatcher(ch)
+			if f.reload > 0 {
+				go f.watch(ch, w.StopChan())
+			}
+			return w, nil
+		},
+	}
+}
+
+// watch sends events on ch for the changes of the file, until stop is closed.
+func (f *podFile) watch(ch chan<- watch.Event, stop <-chan struct{}) {
+	ticker := time.NewTicker(f.reload)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		f.lock.Lock()
+		old := f.pods
+		err := f.read()
+		var events []watch.Event
+		if err == nil {
+			events = diffPods(old, f.pods)
+		}
+		f.lock.Unlock()
+		if err != nil {
+			log.Warningf("Failed to read Pods from %q: %s", f.path, err)
+			continue
+		}
+
+		for _, e := range events {
+			select {
+			case ch <- e:
+			case <-stop:
+				return
+			}
+		}
+	}
+}
+
+// read reads the file if it changed since it was last read.
+func (f *podFile) read() error {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return err
+	}
+	if f.pods != nil && info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return nil
+	}
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return err
+	}
+	pods, err := decodePods(data)
+	if err != nil {
+		return fmt.Errorf("failed to decode Pods: %s", err)
+	}
+	f.pods = make(map[string]*core.Pod, len(pods))
+	for _, pod := range pods {
+		if f.selected(pod) {
+			f.pods[pod.Namespace+"/"+pod.Name] = pod
+		}
+	}
+	f.modTime, f.size = info.ModTime(), info.Size()
+	return nil
+}
+
+// diffPods returns the events that change the Pods in old to the Pods in new.
+func diffPods(old, new map[string]*core.Pod) (events []watch.Event) {
+	for key, pod := range new {
+		oldPod, ok := old[key]
+		switch {
+		case !ok:
+			events = append(events, watch.Event{Type: watch.Added, Object: pod})
+		case !equality.Semantic.DeepEqual(oldPod, pod):
+			events = append(events, watch.Event{Type: watch.Modified, Object: pod})
+		}
+	}
+	for key, pod := range old {
+		if _, ok := new[key]; !ok {
+			events = append(events, watch.Event{Type: watch.Deleted, Object: pod})
+		}
+	}
+	return events
+}
+
+// decodePods decodes the Pods in data, which holds YAML or JSON documents of Pods, PodLists, or
+// Lists of Pods, as written by kubectl get pods -o yaml. Pods without namespace are put in the
+// default namespace.
+func decodePods(data []byte) (pods []*core.Pod, err error) {
+	decoder := yaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), 4096)
+	for {
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		if len(raw) == 0 || string(raw) == "null" {
+			continue
+		}
+		p, err := decodeObject(raw)
+		if err != nil {
+			return nil, err
+		}
+		pods = append(pods, p...)
+	}
+	for _, pod := range pods {
+		if pod.Namespace == "" {
+			pod.Namespace = core.NamespaceDefault
+		}
+	}
+	return pods, nil
+}
+
+// decodeObject decodes the Pods in the JSON object raw.
+func decodeObject(raw []byte) ([]*core.Pod, error) {
+	obj, _, err := scheme.Codecs.UniversalDeserializer().Decode(raw, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	switch o := obj.(type) {
+	case *core.Pod:
+		return []*core.Pod{o}, nil
+	case *core.PodList:
+		pods := make([]*core.Pod, len(o.Items))
+		for i := range o.Items {
+			pods[i] = &o.Items[i]
+		}
+		return pods, nil
+	case *core.List:
+		var pods []*core.Pod
+		for _, item := range o.Items {
+			p, err := decodeObject(item.Raw)
+			if err != nil {
+				return nil, err
+			}
+			pods = append(pods, p...)
+		}
+		return pods, nil
+	}
+	return nil, fmt.Errorf("unexpected %s, expected Pod, PodList or List", obj.GetObjectKind().GroupVersionKind().Kind)
+}
@@ -0,0 +1,139 @@
+package kubepods
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/coredns/coredns/plugin/test"
+)
+
+const podFileYAML = `apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: Pod
+  metadata:
+    name: pod1
+    namespace: namespace1
+  status:
+    podIPs:
+    - ip: 10.0.0.1
+- apiVersion: v1
+  kind: Pod
+  metadata:
+    name: pod2
+    namespace: namespace2
+  status:
+    podIPs:
+    - ip: 10.0.0.2
+---
+apiVersion: v1
+kind: Pod
+metadata:
+  name: pod3
+spec:
+  hostname: host3
+  subdomain: sub3
+status:
+  podIPs:
+  - ip: 10.0.0.3
+`
+
+const podFileJSON = `{
+  "apiVersion": "v1",
+  "kind": "PodList",
+  "items": [
+    {"metadata": {"name": "pod1", "namespace": "namespace1"}, "status": {"podIPs": [{"ip": "10.0.0.11"}]}},
+    {"metadata": {"name": "pod4", "namespace": "namespace1"}, "status": {"podIPs": [{"ip": "10.0.0.4"}]}}
+  ]
+}`
+
+func TestFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "pods.yaml")
+	if err := os.WriteFile(file, []byte(podFileYAML), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	k := New([]string{"cluster.local.", "in-addr.arpa."})
+	k.mode = modeName
+	k.podFile = file
+	k.podReload = 100 * time.Millisecond
+	k.ignoreNamespaces["namespace2"] = true
+	ctx := context.Background()
+
+	k.setWatch(ctx)
+	go k.controller.Run(k.stopCh)
+	defer close(k.stopCh)
+	for atomic.LoadInt32(&k.synced) == 0 {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	runTests(t, ctx, k, []test.Case{
+		{
+			Qname: "pod1.namespace1.cluster.local.", Qtype: dns.TypeA,
+			Rcode:  dns.RcodeSuccess,
+			Answer: []dns.RR{test.A("pod1.namespace1.cluster.local.	5	IN	A	10.0.0.1")},
+		},
+		{
+			Qname: "host3.sub3.default.cluster.local.", Qtype: dns.TypeA,
+			Rcode:  dns.RcodeSuccess,
+			Answer: []dns.RR{test.A("host3.sub3.default.cluster.local.	5	IN	A	10.0.0.3")},
+		},
+		{
+			Qname: "pod2.namespace2.cluster.local.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeNameError,
+			Ns:    []dns.RR{k.soa("cluster.local.")},
+		},
+	})
+
+	// replace the file, with pod1 updated, pod4 added, and pod3 deleted
+	if err := os.WriteFile(file, []byte(podFileJSON), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(file, later, later)
+	for !fileReloaded(k) {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	runTests(t, ctx, k, []test.Case{
+		{
+			Qname: "pod1.namespace1.cluster.local.", Qtype: dns.TypeA,
+			Rcode:  dns.RcodeSuccess,
+			Answer: []dns.RR{test.A("pod1.namespace1.cluster.local.	5	IN	A	10.0.0.11")},
+		},
+		{
+			Qname: "pod4.namespace1.cluster.local.", Qtype: dns.TypeA,
+			Rcode:  dns.RcodeSuccess,
+			Answer: []dns.RR{test.A("pod4.namespace1.cluster.local.	5	IN	A	10.0.0.4")},
+		},
+		{
+			Qname: "host3.sub3.default.cluster.local.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeNameError,
+			Ns:    []dns.RR{k.soa("cluster.local.")},
+		},
+	})
+}
+
+// fileReloaded returns true once all changes of podFileJSON are in the cache.
+func fileReloaded(k *KubePods) bool {
+	pod1, _, _ := k.indexer.GetByKey("namespace1/pod1")
+	_, pod3, _ := k.indexer.GetByKey("default/pod3")
+	_, pod4, _ := k.indexer.GetByKey("namespace1/pod4")
+	return pod1 != nil && pod1.(*podRecord).IPs[0] == "10.0.0.11" && !pod3 && pod4
+}
+
+func TestDecodePodsError(t *testing.T) {
+	if _, err := decodePods([]byte("apiVersion: v1\nkind: Service\nmetadata:\n  name: svc\n")); err == nil {
+		t.Error("Expected error for a Service")
+	}
+	if _, err := decodePods([]byte("{")); err == nil {
+		t.Error("Expected error for invalid JSON")
+	}
+}
@@ -0,0 +1,97 @@
+package kubepods
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+// watchHealth tracks the health of a Pod watch. An open watch without errors is healthy, however
+// long it goes without events.
+type watchHealth struct {
+	failing int64 // unix nanoseconds of the first failure since the last success, 0 if none, set atomically
+}
+
+// success records a successful list, watch or event, which ends a failure.
+func (h *watchHealth) success() {
+	atomic.StoreInt64(&h.failing, 0)
+	watchLastSuccess.SetToCurrentTime()
+}
+
+// failure records a failed list or watch, or an error received on a watch.
+func (h *watchHealth) failure() {
+	atomic.CompareAndSwapInt64(&h.failing, 0, time.Now().UnixNano())
+	watchErrors.Inc()
+}
+
+// failingFor returns how long the watch has been failing, 0 if it is healthy.
+func (h *watchHealth) failingFor() time.Duration {
+	failing := atomic.LoadInt64(&h.failing)
+	if failing == 0 {
+		return 0
+	}
+	return time.Since(time.Unix(0, failing))
+}
+
+// track returns lw with its lists, watches and events recorded in h.
+func (h *watchHealth) track(lw *cache.ListWatch) *cache.ListWatch {
+	return &cache.ListWatch{
+		ListFunc: func(o meta.ListOptions) (runtime.Object, error) {
+			list, err := lw.ListFunc(o)
+			if err != nil {
+				h.failure()
+				return list, err
+			}
+			h.success()
+			return list, nil
+		},
+		WatchFunc: func(o meta.ListOptions) (watch.Interface, error) {
+			w, err := lw.WatchFunc(o)
+			if err != nil {
+				h.failure()
+				return w, err
+			}
+			h.success()
+			return watch.Filter(w, func(e watch.Event) (watch.Event, bool) {
+				if e.Type == watch.Error {
+					h.failure()
+				} else {
+					h.success()
+				}
+				return e, true
+			}), nil
+		},
+	}
+}
+
+// watchFailing returns true if a Pod watch has been failing for longer than the stale threshold.
+// With clusters, it is true if a watch of any cluster is. It is always false without a stale policy.
+func (k *KubePods) watchFailing() bool {
+	if k.stalePolicy == staleIgnore {
+		return false
+	}
+	for _, s := range k.sources() {
+		for _, h := range s.health {
+			if h.failingFor() > k.staleThreshold {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// capTTL lowers the TTL of the records in m to at most ttl.
+func capTTL(m *dns.Msg, ttl uint32) {
+	for _, section := range [][]dns.RR{m.Answer, m.Ns, m.Extra} {
+		for _, rr := range section {
+			if rr.Header().Rrtype != dns.TypeOPT && rr.Header().Ttl > ttl {
+				rr.Header().Ttl = ttl
+			}
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package kubepods
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestWatchHealth(t *testing.T) {
+	fail := true
+	fw := watch.NewFake()
+	lw := &cache.ListWatch{
+		ListFunc: func(o meta.ListOptions) (runtime.Object, error) {
+			if fail {
+				return nil, errors.New("unreachable")
+			}
+			return &core.PodList{}, nil
+		},
+		WatchFunc: func(o meta.ListOptions) (watch.Interface, error) {
+			if fail {
+				return nil, errors.New("unreachable")
+			}
+			return fw, nil
+		},
+	}
+
+	h := &watchHealth{}
+	tracked := h.track(lw)
+	errs := testutil.ToFloat64(watchErrors)
+
+	tracked.List(meta.ListOptions{})
+	failing := atomic.LoadInt64(&h.failing)
+	tracked.Watch(meta.ListOptions{})
+	if c := testutil.ToFloat64(watchErrors); c != errs+2 {
+		t.Errorf("Expected %v watch errors, got %v", errs+2, c)
+	}
+	if failing == 0 || atomic.LoadInt64(&h.failing) != failing {
+		t.Errorf("Expected failing since the first failure, got %v", h.failingFor())
+	}
+
+	fail = false
+	tracked.List(meta.ListOptions{})
+	if h.failingFor() != 0 {
+		t.Errorf("Expected healthy after a list, failing for %v", h.failingFor())
+	}
+
+	h.failure()
+	w, err := tracked.Watch(meta.ListOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if h.failingFor() != 0 {
+		t.Errorf("Expected healthy after a watch, failing for %v", h.failingFor())
+	}
+
+	errs = testutil.ToFloat64(watchErrors)
+	go fw.Error(&meta.Status{})
+	<-w.ResultChan()
+	if c := testutil.ToFloat64(watchErrors); c != errs+1 {
+		t.Errorf("Expected %v watch errors, got %v", errs+1, c)
+	}
+	if h.failingFor() == 0 {
+		t.Error("Expected failing after an error on the watch")
+	}
+
+	go fw.Add(&core.Pod{})
+	<-w.ResultChan()
+	if h.failingFor() != 0 {
+		t.Errorf("Expected healthy after an event, failing for %v", h.failingFor())
+	}
+}
+
+func TestStalePolicy(t *testing.T) {
+	ctx := context.Background()
+	for _, policy := range []int{staleServe, staleFail} {
+		k := New([]string{"cluster.local."})
+		k.mode = modeName
+		k.stalePolicy = policy
+		k.staleThreshold = 500 * time.Millisecond
+		k.staleTTL = 1
+
+		// the Pods can be listed and watched until fail is set
+		var (
+			lock sync.Mutex
+			fail bool
+			fw   *watch.FakeWatcher
+		)
+		client := fake.NewSimpleClientset()
+		client.PrependReactor("list", "pods", func(clienttesting.Action) (bool, runtime.Object, error) {
+			lock.Lock()
+			defer lock.Unlock()
+			if fail {
+				return true, nil, errors.New("unreachable")
+			}
+			return false, nil, nil
+		})
+		client.PrependWatchReactor("pods", func(clienttesting.Action) (bool, watch.Interface, error) {
+			lock.Lock()
+			defer lock.Unlock()
+			if fail {
+				return true, nil, errors.New("unreachable")
+			}
+			fw = watch.NewFake()
+			return true, fw, nil
+		})
+		k.client = client
+		addFixtures(ctx, k)
+		k.setWatch(ctx)
+		go k.controller.Run(k.stopCh)
+		for atomic.LoadInt32(&k.synced) == 0 {
+			time.Sleep(100 * time.Millisecond)
+		}
+
+		// a watch without events stays healthy past the threshold
+		time.Sleep(2 * k.staleThreshold)
+		m := snapshotQuery(t, k, "pod1.namespace1.cluster.local.", true)
+		if m.Rcode != dns.RcodeSuccess || m.Answer[0].Header().Ttl != 5 || isStale(m) {
+			t.Errorf("Expected a fresh answer with a quiet watch, got %v", m)
+		}
+		if !k.Ready() {
+			t.Error("Expected ready with a quiet watch")
+		}
+
+		// the watch fails, and so do the following lists and watches
+		lock.Lock()
+		fail = true
+		w := fw
+		lock.Unlock()
+		if w == nil {
+			t.Fatal("Expected a watch")
+		}
+		w.Error(&meta.Status{})
+		for i := 0; i < 50 && !k.watchFailing(); i++ {
+			time.Sleep(100 * time.Millisecond)
+		}
+		if !k.watchFailing() {
+			t.Fatal("Expected the watch to be failing")
+		}
+
+		switch policy {
+		case staleServe:
+			m := snapshotQuery(t, k, "pod1.namespace1.cluster.local.", true)
+			if m.Rcode != dns.RcodeSuccess || m.Answer[0].Header().Ttl != 1 || !isStale(m) {
+				t.Errorf("Expected a stale answer with TTL 1, got %v", m)
+			}
+			if !k.Ready() {
+				t.Error("Expected ready when serving stale")
+			}
+		case staleFail:
+			r := new(dns.Msg)
+			r.SetQuestion("pod1.namespace1.cluster.local.", dns.TypeA)
+			if rcode, _ := k.ServeDNS(ctx, nil, r); rcode != dns.RcodeServerFailure {
+				t.Errorf("Expected SERVFAIL, got %d", rcode)
+			}
+			if k.Ready() {
+				t.Error("Expected not ready when failing closed")
+			}
+		}
+		close(k.stopCh)
+	}
+}
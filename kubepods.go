@@ -7,14 +7,18 @@ import (
 	"reflect"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"text/template"
 	"time"
 
 	"github.com/miekg/dns"
 	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
 
 	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/metrics"
 	"github.com/coredns/coredns/plugin/pkg/dnsutil"
 	"github.com/coredns/coredns/plugin/pkg/fall"
 	"github.com/coredns/coredns/request"
@@ -25,16 +29,80 @@ type KubePods struct {
 	Next  plugin.Handler
 	Zones []string
 
-	Fall fall.F
-	ttl  uint32
-	mode int
+	Fall  fall.F
+	ttl   uint32
+	mode  int // naming mode of the zones not in zoneModes
+	serve int
+
+	// naming modes of zones, by zone
+	zoneModes map[string]int
+
+	// PTR targets are only in ptrZone if set, and only the first if ptrCanonical
+	ptrZone      string
+	ptrCanonical bool
+
+	// template builds the record names in modeTemplate
+	template *template.Template
+
+	// addresses provides the Pods' addresses
+	addresses AddressSource
+
+	// ownerRecords serves records for the Pods of controllers
+	ownerRecords bool
+
+	// label keys that records are served for, by their name in queries
+	labelKeys map[string]string
+
+	// namespaceRecords is the maximum number of records answered for a namespace, 0 if they are not served
+	namespaceRecords int
 
 	autoPathSearch []string
 
+	// selection of the Pods that records are created for
+	namespaces       map[string]bool
+	ignoreNamespaces map[string]bool
+	labelSelector    labels.Selector
+	namespaced       bool   // one informer per namespace in namespaces
+	node             string // only the Pods on this node
+
+	// number of Pods and addresses in the cache, set atomically
+	podCount int64
+	ipCount  int64
+
+	// clusters whose Pods are answered in subzones, instead of the Pods of a single cluster
+	clusters []*cluster
+
+	// file to read the Pods from instead of the Kubernetes API
+	podFile   string
+	podReload time.Duration
+
 	// Kubernetes API interface
 	client     kubernetes.Interface
 	controller cache.Controller
-	indexer    cache.Indexer
+	indexer    podIndexer
+
+	// zone serial and journal of Pod changes for zone transfers
+	journalLock sync.Mutex
+	serial      uint32
+	journal     []change
+	notifyCh    chan struct{}
+	synced      int32 // set atomically once the initial list of Pods is in the cache
+
+	// behaviour for queries received before the Pod cache has synced
+	unsynced        int
+	unsyncedTimeout time.Duration
+	syncedCh        chan struct{} // closed once the initial list of Pods is in the cache
+
+	// health of the Pod watches, and what is done once they have been failing for staleThreshold
+	health         []*watchHealth
+	stalePolicy    int
+	staleThreshold time.Duration
+	staleTTL       uint32
+
+	// snapshot of the cached Pods, to serve before the initial list of Pods is received
+	snapshotFile     string
+	snapshotInterval time.Duration
+	snapshotLoaded   int32 // set atomically once the snapshot is in the cache
 
 	// concurrency control to stop controller
 	stopLock sync.Mutex
@@ -47,6 +115,26 @@ const (
 	modeIP
 	modeName
 	modeNameAndIP
+	modeTemplate
+)
+
+const (
+	serveAll = iota
+	serveRunning
+	serveReady
+)
+
+const (
+	unsyncedServe = iota // answer from the Pods cached so far
+	unsyncedServfail
+	unsyncedFallthrough
+	unsyncedWait
+)
+
+const (
+	staleIgnore = iota // keep serving the cached Pods as they are
+	staleServe         // keep serving the cached Pods with a capped TTL
+	staleFail          // answer with SERVFAIL
 )
 
 // New returns a initialized KubePods.
@@ -54,7 +142,15 @@ func New(zones []string) *KubePods {
 	k := new(KubePods)
 	k.Zones = zones
 	k.ttl = defaultTTL
+	k.addresses = defaultAddressSource
+	k.zoneModes = make(map[string]int)
+	k.labelKeys = make(map[string]string)
+	k.namespaces = make(map[string]bool)
+	k.ignoreNamespaces = make(map[string]bool)
 	k.stopCh = make(chan struct{})
+	k.serial = uint32(time.Now().Unix())
+	k.notifyCh = make(chan struct{}, 1)
+	k.syncedCh = make(chan struct{})
 	return k
 }
 
@@ -67,7 +163,7 @@ const (
 func (k *KubePods) Name() string { return "kubepods" }
 
 // ServeDNS implements the plugin.Handler interface.
-func (k *KubePods) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+func (k *KubePods) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (rcode int, err error) {
 	state := request.Request{W: w, Req: r}
 
 	qname := state.Name()
@@ -75,43 +171,41 @@ func (k *KubePods) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Ms
 	if zone == "" {
 		return plugin.NextOrFailure(k.Name(), k.Next, ctx, w, r)
 	}
+	mode := k.zoneMode(zone)
 	zone = state.QName()[len(qname)-len(zone):] // maintain case of original query
 	state.Zone = zone
 
-	// query for just the zone results in NODATA
-	if len(zone) == len(qname) {
-		return k.nodata(state)
+	if len(k.clusters) > 0 {
+		return k.serveClusters(ctx, state)
 	}
 
-	// handle reverse lookup
-	if state.QType() == dns.TypePTR {
-		addr := dnsutil.ExtractAddressFromReverse(qname)
-		if addr == "" {
-			return k.nxdomain(ctx, state)
-		}
-		var records []dns.RR
-		if k.mode == modeEchoIP {
-			// In EchoIP mode, we cannot synthesize a PTR record because it's impossible to
-			// know what namespace to use in the PTR target. So return an NXDOMAIN.
-			return k.nxdomain(ctx, state)
-		}
-		objs, err := k.indexer.ByIndex("reverse", addr)
-		if err != nil {
-			return dns.RcodeServerFailure, err
-		}
-		if len(objs) == 0 {
-			return k.nxdomain(ctx, state)
-		}
-		for _, obj := range objs {
-			pod, ok := obj.(*core.Pod)
-			if !ok {
-				return dns.RcodeServerFailure, fmt.Errorf("unexpected %q from *Pod index", reflect.TypeOf(obj))
-			}
-			records = append(records, k.ptr(state.QName(), addr, pod)...)
+	start := time.Now()
+	path := pathOther
+	defer func() { reportRequest(metrics.WithServer(ctx), state.QType(), rcode, path, start) }()
+
+	// query for just the zone, or its name server
+	if len(zone) == len(qname) || qname == nsName(zone) {
+		path = pathApex
+		return k.serveApex(state)
+	}
+
+	// echo-ip answers don't read the Pod cache
+	cached := mode != modeEchoIP || (isReverseZone(qname) && !k.echoOnly())
+	if cached && k.unsynced != unsyncedServe && !k.hasSynced() {
+		if rcode, done, err := k.serveUnsynced(ctx, state); done {
+			path = pathUnsynced
+			return rcode, err
 		}
+	}
+	if cached && k.stalePolicy == staleFail && k.watchFailing() {
+		path = pathStale
+		return dns.RcodeServerFailure, nil
+	}
 
-		writeResponse(w, r, records, nil, nil, dns.RcodeSuccess)
-		return dns.RcodeSuccess, nil
+	// handle reverse lookup, PTR queries for forward names are answered as such
+	if isReverseZone(qname) {
+		path = pathPTR
+		return k.serveReverse(ctx, state)
 	}
 
 	// handle lookup
@@ -119,157 +213,553 @@ func (k *KubePods) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Ms
 	if zone == "." {
 		podDomain = state.Name()[0 : len(qname)-len(zone)]
 	}
+	if k.ownerRecords && mode != modeEchoIP {
+		// owner.kind.namespace for the Pods of a controller
+		if rcode, done, err := k.serveOwner(state, podDomain); done {
+			path = pathOwner
+			return rcode, err
+		}
+	}
+	if len(k.labelKeys) > 0 && mode != modeEchoIP {
+		// value.key.label.namespace for the Pods with a label
+		if rcode, done, err := k.serveLabel(state, podDomain); done {
+			path = pathLabel
+			return rcode, err
+		}
+	}
+	if mode == modeTemplate {
+		path = pathTemplate
+		return k.serveTemplate(ctx, state, podDomain)
+	}
 	podSegments := dns.SplitDomainName(podDomain)
 
 	var items []interface{}
 
-	switch len(podSegments) {
-	case 2:
-		// get the pod by key name from the indexer
-		podKey := strings.Join([]string{podSegments[1], "/", podSegments[0]}, "")
-		var err error
-		if k.mode == modeEchoIP {
-			ip := net.ParseIP(undashIP(podSegments[0]))
-			if ip == nil {
-				return k.nxdomain(ctx, state)
-			}
-			var records []dns.RR
-			if ip.To4() == nil {
-				records = []dns.RR{&dns.AAAA{AAAA: ip, Hdr: dns.RR_Header{Name: qname, Rrtype: dns.TypeAAAA, Class: dns.ClassINET, Ttl: k.ttl}}}
-			} else {
-				records = []dns.RR{&dns.A{A: ip, Hdr: dns.RR_Header{Name: qname, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: k.ttl}}}
+	switch n := len(podSegments); {
+	case n > 2 && strings.HasPrefix(podSegments[0], "_"):
+		// _port._proto.pod.namespace for SRV lookups of named container ports, below _proto.pod.namespace
+		if mode == modeEchoIP {
+			break
+		}
+		path = pathSRV
+		return k.serveSRV(ctx, state, mode, podSegments)
+	case n == 2 && mode == modeEchoIP:
+		path = pathEcho
+		if !k.namespaceExposed(podSegments[1]) {
+			return k.nxdomain(ctx, state)
+		}
+		ip := net.ParseIP(undashIP(podSegments[0]))
+		if ip == nil {
+			return k.nxdomain(ctx, state)
+		}
+		records := k.ipRecords(qname, state.QType(), []string{ip.String()})
+		if len(records) == 0 {
+			return k.nodata(state)
+		}
+		k.writeResponse(w, r, records, nil, nil, dns.RcodeSuccess)
+		return dns.RcodeSuccess, nil
+	case n > 1 && mode != modeEchoIP:
+		// pod.namespace, where the Pod's name can have dots
+		name, namespace := strings.Join(podSegments[:n-1], "."), podSegments[n-1]
+		path = pathName
+		if mode == modeIP || (mode == modeNameAndIP && net.ParseIP(undashIP(name)) != nil) {
+			path = pathDashedIP
+		}
+		if n > 2 && (mode == modeName || mode == modeNameAndIP) {
+			// pod.network.namespace for the addresses of the Pod on a secondary network
+			rcode, done, err := k.serveNetwork(state, strings.Join(podSegments[:n-2], "."), podSegments[n-2], namespace)
+			if done {
+				path = pathNetwork
+				return rcode, err
 			}
-			writeResponse(w, r, records, nil, nil, dns.RcodeSuccess)
-			return dns.RcodeSuccess, nil
 		}
 
-		if k.mode == modeIP || k.mode == modeNameAndIP {
-			items, err = k.indexer.ByIndex("dashedip", podKey)
+		items, err = k.podsByName(name, namespace, mode)
+		if err != nil {
+			return dns.RcodeServerFailure, err
+		}
+
+		if n == 3 && (mode == modeName || mode == modeNameAndIP) {
+			// hostname.subdomain.namespace, as set in the Pod's spec
+			hostItems, err := k.indexer.ByIndex("hostname", strings.Join([]string{podSegments[2], podSegments[1], podSegments[0]}, "/"))
 			if err != nil {
 				return dns.RcodeServerFailure, err
 			}
+			if len(hostItems) > 0 {
+				path = pathHostname
+			}
+			items = appendItems(items, hostItems)
 		}
 
-		if k.mode == modeName || k.mode == modeNameAndIP {
-			item, exists, err := k.indexer.GetByKey(podKey)
+		served, err := k.servedPods(items)
+		if err != nil {
+			return dns.RcodeServerFailure, err
+		}
+		if len(served) == 0 && (mode == modeName || mode == modeNameAndIP) {
+			// the name is an empty non-terminal if it is the end of a Pod name with dots
+			ents, err := k.indexer.ByIndex("ent", strings.Join([]string{namespace, name}, "/"))
+			if err != nil {
+				return dns.RcodeServerFailure, err
+			}
+			if len(ents) > 0 {
+				return k.nodata(state)
+			}
+		}
+		if len(served) == 0 {
+			// the name can be above the names of groups of Pods, which are served in every mode
+			ent, err := k.groupENT(podDomain)
 			if err != nil {
 				return dns.RcodeServerFailure, err
 			}
-			if exists {
-				items = append(items, item)
+			if ent {
+				return k.nodata(state)
 			}
 		}
-	case 1:
+	case n == 1:
 		// query only contains the namespace
-		if k.mode == modeEchoIP {
+		path = pathNamespace
+		if mode == modeEchoIP {
 			// in echo mode, every possible namespace domain exists
+			if !k.namespaceExposed(podSegments[0]) {
+				return k.nxdomain(ctx, state)
+			}
 			return k.nodata(state)
 		}
 		items, err := k.indexer.ByIndex("namespace", podSegments[0])
 		if err != nil {
 			return dns.RcodeServerFailure, err
 		}
-		// if any pods exist in the namespace, return NODATA
+		// if any pods exist in the namespace, return their addresses or NODATA
+		if len(items) > 0 && k.namespaceRecords > 0 {
+			return k.serveNamespace(state, items)
+		}
 		if len(items) > 0 {
 			return k.nodata(state)
 		}
 	}
 
-	if len(items) == 0 {
+	pods, err := k.servedPods(items)
+	if err != nil {
+		return dns.RcodeServerFailure, err
+	}
+	if len(pods) == 0 {
 		return k.nxdomain(ctx, state)
 	}
 
 	var records []dns.RR
+	for _, pod := range pods {
+		records = append(records, k.addressRecords(qname, state.QType(), pod)...)
+	}
+	if len(records) == 0 {
+		return k.nodata(state)
+	}
+
+	k.writeResponse(w, r, records, nil, nil, dns.RcodeSuccess)
+	return dns.RcodeSuccess, nil
+}
+
+// zoneMode returns the naming mode of zone, which is one of k's zones.
+func (k *KubePods) zoneMode(zone string) int {
+	if mode, ok := k.zoneModes[zone]; ok {
+		return mode
+	}
+	return k.mode
+}
+
+// echoOnly returns true if all zones use modeEchoIP, in which case no Pods are needed.
+func (k *KubePods) echoOnly() bool {
+	for _, zone := range k.Zones {
+		if k.zoneMode(zone) != modeEchoIP {
+			return false
+		}
+	}
+	return true
+}
+
+// namespaceExposed returns true if records are created for the Pods in namespace.
+func (k *KubePods) namespaceExposed(namespace string) bool {
+	if len(k.namespaces) > 0 && !k.namespaces[namespace] {
+		return false
+	}
+	return !k.ignoreNamespaces[namespace]
+}
+
+// podSelected returns true if pod is selected by the namespaces and node.
+func (k *KubePods) podSelected(pod *core.Pod) bool {
+	if k.node != "" && pod.Spec.NodeName != k.node {
+		return false
+	}
+	return k.namespaceExposed(pod.Namespace)
+}
+
+// podsByName returns the Pods in namespace matching name, which is a Pod name or
+// a dashed IP depending on mode.
+func (k *KubePods) podsByName(name, namespace string, mode int) ([]interface{}, error) {
+	var items []interface{}
+	podKey := strings.Join([]string{namespace, "/", name}, "")
+
+	if mode == modeIP || mode == modeNameAndIP {
+		var err error
+		items, err = k.indexer.ByIndex("dashedip", podKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if mode == modeName || mode == modeNameAndIP {
+		item, exists, err := k.indexer.GetByKey(podKey)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+// appendItems appends the items in b to a that are not in a yet.
+func appendItems(a, b []interface{}) []interface{} {
+	for _, item := range b {
+		found := false
+		for _, i := range a {
+			if i == item {
+				found = true
+				break
+			}
+		}
+		if !found {
+			a = append(a, item)
+		}
+	}
+	return a
+}
+
+// servedPods returns the Pods in items that are served according to the serve policy.
+func (k *KubePods) servedPods(items []interface{}) ([]*podRecord, error) {
+	pods := make([]*podRecord, 0, len(items))
 	for _, item := range items {
-		pod, ok := item.(*core.Pod)
+		pod, ok := item.(*podRecord)
 		if !ok {
-			return dns.RcodeServerFailure, fmt.Errorf("unexpected %q from *Pod index", reflect.TypeOf(item))
-		}
-
-		// add response records
-		if state.QType() == dns.TypeA {
-			for _, podIP := range pod.Status.PodIPs {
-				if strings.Contains(podIP.IP, ":") {
-					continue
-				}
-				if netIP := net.ParseIP(podIP.IP); netIP != nil {
-					records = append(records, &dns.A{A: netIP,
-						Hdr: dns.RR_Header{Name: qname, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: k.ttl}})
-				}
-			}
+			return nil, fmt.Errorf("unexpected %q from *Pod index", reflect.TypeOf(item))
 		}
-		if state.QType() == dns.TypeAAAA {
-			for _, podIP := range pod.Status.PodIPs {
-				if !strings.Contains(podIP.IP, ":") {
-					continue
-				}
-				if netIP := net.ParseIP(podIP.IP); netIP != nil {
-					records = append(records, &dns.AAAA{AAAA: netIP,
-						Hdr: dns.RR_Header{Name: qname, Rrtype: dns.TypeAAAA, Class: dns.ClassINET, Ttl: k.ttl}})
-				}
-			}
+		if k.serves(pod) {
+			pods = append(pods, pod)
 		}
 	}
+	return pods, nil
+}
 
-	writeResponse(w, r, records, nil, nil, dns.RcodeSuccess)
-	return dns.RcodeSuccess, nil
+// podByIP returns the Pod with the address ip, or nil if there is none. With clusters, it is the
+// Pod of the first cluster that has one.
+func (k *KubePods) podByIP(ip string) (*podRecord, error) {
+	for _, c := range k.clusters {
+		if pod, err := c.podByIP(ip); err != nil || pod != nil {
+			return pod, err
+		}
+	}
+	if k.indexer == nil {
+		return nil, nil
+	}
+	items, err := k.indexer.ByIndex("reverse", ip)
+	if err != nil {
+		return nil, err
+	}
+	pods := make([]*podRecord, 0, len(items))
+	for _, item := range items {
+		pod, ok := item.(*podRecord)
+		if !ok {
+			return nil, fmt.Errorf("unexpected %q from *Pod index", reflect.TypeOf(item))
+		}
+		pods = append(pods, pod)
+	}
+	return preferredPod(pods), nil
+}
+
+// preferredPod returns the Pod from pods that most likely uses their shared address. Addresses
+// are shared when a terminated Pod keeps its address after it is reused, or by Pods on the host
+// network. Pods that have not terminated are preferred, then Pods not on the host network, then
+// the most recently created. It returns nil if pods is empty.
+func preferredPod(pods []*podRecord) *podRecord {
+	if len(pods) == 0 {
+		return nil
+	}
+	if len(pods) > 1 {
+		ipCollisions.Inc()
+	}
+	best := pods[0]
+	for _, pod := range pods[1:] {
+		if preferPod(pod, best) {
+			best = pod
+		}
+	}
+	return best
+}
+
+// preferPod returns true if a is preferred over b, see preferredPod.
+func preferPod(a, b *podRecord) bool {
+	if ta, tb := terminated(a), terminated(b); ta != tb {
+		return !ta
+	}
+	if a.HostNetwork != b.HostNetwork {
+		return !a.HostNetwork
+	}
+	if !a.Created.Equal(&b.Created) {
+		return b.Created.Before(&a.Created)
+	}
+	// tie breaker to be deterministic
+	if a.Namespace != b.Namespace {
+		return a.Namespace < b.Namespace
+	}
+	return a.Name < b.Name
+}
+
+// terminated returns true if all of pod's containers have terminated.
+func terminated(pod *podRecord) bool {
+	return pod.Phase == core.PodSucceeded || pod.Phase == core.PodFailed
+}
+
+// serves returns true if records are served for pod according to the serve policy.
+func (k *KubePods) serves(pod *podRecord) bool {
+	switch k.serve {
+	case serveRunning:
+		return pod.Phase == core.PodRunning
+	case serveReady:
+		return pod.Phase == core.PodRunning && pod.Ready
+	}
+	return true
+}
+
+// addressRecords returns the records of type qtype with the addresses of pod, using name as the owner name.
+func (k *KubePods) addressRecords(name string, qtype uint16, pod *podRecord) []dns.RR {
+	return k.ipRecords(name, qtype, pod.IPs)
+}
+
+// ipRecords returns the records of type qtype for the addresses in ips, using name as the owner name.
+func (k *KubePods) ipRecords(name string, qtype uint16, ips []string) (records []dns.RR) {
+	for _, ip := range ips {
+		netIP := net.ParseIP(ip)
+		if netIP == nil {
+			continue
+		}
+		if qtype == dns.TypeA && !strings.Contains(ip, ":") {
+			records = append(records, &dns.A{A: netIP,
+				Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: k.ttl}})
+		}
+		if qtype == dns.TypeAAAA && strings.Contains(ip, ":") {
+			records = append(records, &dns.AAAA{AAAA: netIP,
+				Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeAAAA, Class: dns.ClassINET, Ttl: k.ttl}})
+		}
+	}
+	return records
 }
 
 func (k *KubePods) nxdomain(ctx context.Context, state request.Request) (int, error) {
 	if k.Fall.Through(state.Name()) {
 		return plugin.NextOrFailure(k.Name(), k.Next, ctx, state.W, state.Req)
 	}
-	writeResponse(state.W, state.Req, nil, nil, []dns.RR{k.soa()}, dns.RcodeNameError)
+	k.writeResponse(state.W, state.Req, nil, nil, []dns.RR{k.soa(state.Zone)}, dns.RcodeNameError)
 	return dns.RcodeNameError, nil
 }
 
 func (k *KubePods) nodata(state request.Request) (int, error) {
-	writeResponse(state.W, state.Req, nil, nil, []dns.RR{k.soa()}, dns.RcodeSuccess)
+	k.writeResponse(state.W, state.Req, nil, nil, []dns.RR{k.soa(state.Zone)}, dns.RcodeSuccess)
+	return dns.RcodeSuccess, nil
+}
+
+// serveApex answers queries for the zone itself, which only has the SOA and NS records, and for
+// its name server, which has the address the query was received on.
+func (k *KubePods) serveApex(state request.Request) (int, error) {
+	if state.Name() == nsName(state.Zone) {
+		// the name server is the server answering the query
+		records := k.ipRecords(state.QName(), state.QType(), []string{state.LocalIP()})
+		if len(records) == 0 {
+			return k.nodata(state)
+		}
+		k.writeResponse(state.W, state.Req, records, nil, nil, dns.RcodeSuccess)
+		return dns.RcodeSuccess, nil
+	}
+
+	var records []dns.RR
+	switch state.QType() {
+	case dns.TypeSOA:
+		records = []dns.RR{k.soa(state.Zone)}
+	case dns.TypeNS:
+		records = []dns.RR{&dns.NS{
+			Hdr: dns.RR_Header{Name: state.Zone, Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: k.ttl},
+			Ns:  nsName(state.Zone),
+		}}
+	default:
+		return k.nodata(state)
+	}
+	k.writeResponse(state.W, state.Req, records, nil, nil, dns.RcodeSuccess)
+	return dns.RcodeSuccess, nil
+}
+
+// nsName returns the name of the name server of zone, ns.dns.<zone>.
+func nsName(zone string) string {
+	return dnsutil.Join("ns.dns", zone)
+}
+
+// serveReverse answers queries for names in the reverse zones, with the PTR records of the Pods
+// with the address in all sources. Names of partial addresses are empty non-terminals if the
+// address of a served Pod is below them.
+func (k *KubePods) serveReverse(ctx context.Context, state request.Request) (int, error) {
+	if k.echoOnly() {
+		// In EchoIP mode, we cannot synthesize a PTR record because it's impossible to
+		// know what namespace to use in the PTR target. So return an NXDOMAIN.
+		return k.nxdomain(ctx, state)
+	}
+
+	var records []dns.RR
+	ent := false
+	for _, s := range k.sources() {
+		rrs, e, err := s.reverseRecords(state)
+		if err != nil {
+			return dns.RcodeServerFailure, err
+		}
+		records = append(records, rrs...)
+		ent = ent || e
+	}
+
+	switch {
+	case len(records) == 0 && !ent:
+		return k.nxdomain(ctx, state)
+	case len(records) == 0 || state.QType() != dns.TypePTR:
+		return k.nodata(state)
+	}
+	k.writeResponse(state.W, state.Req, records, nil, nil, dns.RcodeSuccess)
 	return dns.RcodeSuccess, nil
 }
 
-func (k *KubePods) ptr(qname, qip string, pod *core.Pod) (ptrs []dns.RR) {
-	if k.mode == modeName || k.mode == modeNameAndIP {
-		ptr := &dns.PTR{
+// reverseRecords returns the PTR records for the reverse name queried in state, and whether
+// the name is an empty non-terminal.
+func (k *KubePods) reverseRecords(state request.Request) (records []dns.RR, ent bool, err error) {
+	addr := dnsutil.ExtractAddressFromReverse(state.Name())
+	if addr == "" {
+		ent, err = k.reverseENT(state.Name())
+		return nil, ent, err
+	}
+	objs, err := k.indexer.ByIndex("reverse", addr)
+	if err != nil {
+		return nil, false, err
+	}
+	pods, err := k.servedPods(objs)
+	if err != nil {
+		return nil, false, err
+	}
+	if pod := preferredPod(pods); pod != nil {
+		records = k.ptr(state.QName(), addr, pod)
+	}
+	return records, false, nil
+}
+
+// reverseENT returns true if the reverse name of the address of a served Pod is below name.
+func (k *KubePods) reverseENT(name string) (bool, error) {
+	items, err := k.indexer.ByIndex("reverseent", name)
+	if err != nil {
+		return false, err
+	}
+	return len(items) > 0, nil
+}
+
+// ptr returns the PTR records for the address qip of pod, with a target in each zone whose
+// mode has names for the address, or in ptrZone if set. If ptrCanonical is set, only the
+// first target is returned: the Pod's name before its hostname and dashed IP, in the first zone.
+func (k *KubePods) ptr(qname, qip string, pod *podRecord) (ptrs []dns.RR) {
+	zones := k.Zones
+	if k.ptrZone != "" {
+		zones = []string{k.ptrZone}
+	}
+
+	var targets []string
+	for _, zone := range zones {
+		if !isReverseZone(zone) {
+			targets = append(targets, k.ptrTargets(zone, qip, pod)...)
+		}
+	}
+	if k.ptrCanonical && len(targets) > 1 {
+		targets = targets[:1]
+	}
+
+	for _, target := range targets {
+		ptrs = append(ptrs, &dns.PTR{
 			Hdr: dns.RR_Header{Name: qname, Rrtype: dns.TypePTR, Class: dns.ClassINET, Ttl: k.ttl},
-			Ptr: dnsutil.Join(pod.Name, pod.Namespace, k.Zones[0]),
+			Ptr: target,
+		})
+	}
+	return ptrs
+}
+
+// ptrTargets returns the names of pod for the address qip in zone.
+func (k *KubePods) ptrTargets(zone, qip string, pod *podRecord) (targets []string) {
+	mode := k.zoneMode(zone)
+	if network := pod.network(qip); network != "" {
+		// addresses on secondary networks only have the per network name
+		if mode == modeName || mode == modeNameAndIP {
+			targets = append(targets, dnsutil.Join(pod.Name, network, pod.Namespace, zone))
+		}
+		return targets
+	}
+
+	if mode == modeName || mode == modeNameAndIP {
+		targets = append(targets, dnsutil.Join(pod.Name, pod.Namespace, zone))
+		if pod.Hostname != "" && pod.Subdomain != "" {
+			targets = append(targets, dnsutil.Join(pod.Hostname, pod.Subdomain, pod.Namespace, zone))
 		}
-		ptrs = append(ptrs, ptr)
 	}
 
-	if k.mode == modeIP || k.mode == modeNameAndIP {
-		for _, ip := range pod.Status.PodIPs {
-			if qip != ip.IP {
-				continue
+	if mode == modeTemplate {
+		for _, n := range pod.Names {
+			if qip == n.IP {
+				targets = append(targets, dnsutil.Join(n.Name, zone))
 			}
-			ptr := &dns.PTR{
-				Hdr: dns.RR_Header{Name: qname, Rrtype: dns.TypePTR, Class: dns.ClassINET, Ttl: k.ttl},
-				Ptr: dnsutil.Join(dashIP(ip.IP), pod.Namespace, k.Zones[0]),
+		}
+	}
+
+	if mode == modeIP || mode == modeNameAndIP {
+		for _, ip := range pod.IPs {
+			if qip == ip {
+				targets = append(targets, dnsutil.Join(dashIP(ip), pod.Namespace, zone))
 			}
-			ptrs = append(ptrs, ptr)
 		}
 	}
 
-	return ptrs
+	return targets
 }
 
-func writeResponse(w dns.ResponseWriter, r *dns.Msg, answer, extra, ns []dns.RR, rcode int) {
+func (k *KubePods) writeResponse(w dns.ResponseWriter, r *dns.Msg, answer, extra, ns []dns.RR, rcode int) {
 	m := new(dns.Msg)
 	m.SetReply(r)
 	m.Rcode = rcode
 	m.Authoritative = true
-	m.Answer = answer
-	m.Extra = extra
+	// Pods with the same address can have the same records, e.g. for dashed IPs
+	m.Answer = dns.Dedup(answer, nil)
+	m.Extra = dns.Dedup(extra, nil)
 	m.Ns = ns
+	if k.stale() {
+		markStale(r, m, "Pods from snapshot")
+	} else if k.stalePolicy == staleServe && k.watchFailing() {
+		capTTL(m, k.staleTTL)
+		markStale(r, m, "Pod watch failing")
+	}
+	// fit the answer in the client's buffer, setting TC if records are left out
+	state := request.Request{W: w, Req: r}
+	m.Truncate(state.Size())
 	w.WriteMsg(m)
 }
 
-func (k *KubePods) soa() *dns.SOA {
+// soa returns the SOA record of zone.
+func (k *KubePods) soa(zone string) *dns.SOA {
+	k.journalLock.Lock()
+	serial := k.serial
+	k.journalLock.Unlock()
+
 	return &dns.SOA{
-		Hdr:     dns.RR_Header{Name: k.Zones[0], Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: k.ttl},
-		Ns:      dnsutil.Join("ns.dns", k.Zones[0]),
-		Mbox:    dnsutil.Join("hostmaster.dns", k.Zones[0]),
-		Serial:  uint32(time.Now().Unix()),
+		Hdr:     dns.RR_Header{Name: zone, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: k.ttl},
+		Ns:      nsName(zone),
+		Mbox:    dnsutil.Join("hostmaster.dns", zone),
+		Serial:  serial,
 		Refresh: 7200,
 		Retry:   1800,
 		Expire:  86400,
@@ -279,8 +769,19 @@ func (k *KubePods) soa() *dns.SOA {
 
 // Ready implements the ready.Readiness interface.
 func (k *KubePods) Ready() bool {
-	if k.mode == modeEchoIP {
+	if k.echoOnly() {
+		return true
+	}
+	if len(k.clusters) > 0 {
+		for _, c := range k.clusters {
+			if !c.Ready() {
+				return false
+			}
+		}
 		return true
 	}
-	return k.controller.HasSynced()
+	if k.stalePolicy == staleFail && k.watchFailing() {
+		return false
+	}
+	return k.controller.HasSynced() || atomic.LoadInt32(&k.snapshotLoaded) == 1
 }
@@ -8,6 +8,7 @@ import (
 	"github.com/miekg/dns"
 	core "k8s.io/api/core/v1"
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/kubernetes/fake"
 
 	"github.com/coredns/coredns/plugin/pkg/dnstest"
@@ -57,30 +58,86 @@ func TestServeDNSModeName(t *testing.T) {
 				test.PTR("4.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.3.0.0.0.2.0.0.0.1.0.0.0.ip6.arpa.	5	IN	PTR	pod1.namespace1.cluster.local."),
 			},
 		},
+		{
+			Qname: "host3.sub3.namespace1.cluster.local.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeSuccess,
+			Answer: []dns.RR{
+				test.A("host3.sub3.namespace1.cluster.local.	5	IN	A	10.0.0.3"),
+			},
+		},
+		{
+			Qname: "host3.nonexistent-sub.namespace1.cluster.local.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeNameError,
+			Ns:    []dns.RR{k.soa("cluster.local.")},
+		},
+		{
+			Qname: "3.0.0.10.in-addr.arpa.", Qtype: dns.TypePTR,
+			Rcode: dns.RcodeSuccess,
+			Answer: []dns.RR{
+				test.PTR("3.0.0.10.in-addr.arpa.	5	IN	PTR	host3.sub3.namespace1.cluster.local."),
+				test.PTR("3.0.0.10.in-addr.arpa.	5	IN	PTR	pod3.namespace1.cluster.local."),
+			},
+		},
+		{
+			Qname: "_http._tcp.pod1.namespace1.cluster.local.", Qtype: dns.TypeSRV,
+			Rcode: dns.RcodeSuccess,
+			Answer: []dns.RR{
+				test.SRV("_http._tcp.pod1.namespace1.cluster.local.	5	IN	SRV	0 100 80 pod1.namespace1.cluster.local."),
+			},
+			Extra: []dns.RR{
+				test.A("pod1.namespace1.cluster.local.	5	IN	A	1.2.3.4"),
+				test.A("pod1.namespace1.cluster.local.	5	IN	A	5.6.7.8"),
+				test.AAAA("pod1.namespace1.cluster.local.	5	IN	AAAA	1:2:3::4"),
+				test.AAAA("pod1.namespace1.cluster.local.	5	IN	AAAA	5:6:7::8"),
+			},
+		},
+		{
+			Qname: "_dns._udp.pod1.namespace1.cluster.local.", Qtype: dns.TypeSRV,
+			Rcode: dns.RcodeSuccess,
+			Answer: []dns.RR{
+				test.SRV("_dns._udp.pod1.namespace1.cluster.local.	5	IN	SRV	0 100 53 pod1.namespace1.cluster.local."),
+			},
+			Extra: []dns.RR{
+				test.A("pod1.namespace1.cluster.local.	5	IN	A	1.2.3.4"),
+				test.A("pod1.namespace1.cluster.local.	5	IN	A	5.6.7.8"),
+				test.AAAA("pod1.namespace1.cluster.local.	5	IN	AAAA	1:2:3::4"),
+				test.AAAA("pod1.namespace1.cluster.local.	5	IN	AAAA	5:6:7::8"),
+			},
+		},
+		{
+			Qname: "_http._tcp.pod1.namespace1.cluster.local.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeSuccess,
+			Ns:    []dns.RR{k.soa("cluster.local.")},
+		},
+		{
+			Qname: "_http._udp.pod1.namespace1.cluster.local.", Qtype: dns.TypeSRV,
+			Rcode: dns.RcodeNameError,
+			Ns:    []dns.RR{k.soa("cluster.local.")},
+		},
 		{
 			Qname: "cluster.local.", Qtype: dns.TypeA,
 			Rcode: dns.RcodeSuccess,
-			Ns:    []dns.RR{k.soa()},
+			Ns:    []dns.RR{k.soa("cluster.local.")},
 		},
 		{
 			Qname: "namespace1.cluster.local.", Qtype: dns.TypeA,
 			Rcode: dns.RcodeSuccess,
-			Ns:    []dns.RR{k.soa()},
+			Ns:    []dns.RR{k.soa("cluster.local.")},
 		},
 		{
 			Qname: "nonexistent-namespace.cluster.local.", Qtype: dns.TypeA,
 			Rcode: dns.RcodeNameError,
-			Ns:    []dns.RR{k.soa()},
+			Ns:    []dns.RR{k.soa("cluster.local.")},
 		},
 		{
 			Qname: "nonexistent-pod.nonexistent-namespace.cluster.local.", Qtype: dns.TypeA,
 			Rcode: dns.RcodeNameError,
-			Ns:    []dns.RR{k.soa()},
+			Ns:    []dns.RR{k.soa("cluster.local.")},
 		},
 		{
 			Qname: "nonexistent-pod.nonexistent-namespace.cluster.local.", Qtype: dns.TypeMX,
 			Rcode: dns.RcodeNameError,
-			Ns:    []dns.RR{k.soa()},
+			Ns:    []dns.RR{k.soa("cluster.local.")},
 		},
 	}
 
@@ -146,37 +203,78 @@ func TestServeDNSModeIP(t *testing.T) {
 		{
 			Qname: "1-2-3-5.namespace1.cluster.local.", Qtype: dns.TypeA,
 			Rcode: dns.RcodeNameError,
-			Ns:    []dns.RR{k.soa()},
+			Ns:    []dns.RR{k.soa("cluster.local.")},
 		},
 		{
 			Qname: "pod1.namespace1.cluster.local.", Qtype: dns.TypeA,
 			Rcode: dns.RcodeNameError,
-			Ns:    []dns.RR{k.soa()},
+			Ns:    []dns.RR{k.soa("cluster.local.")},
+		},
+		{
+			Qname: "host3.sub3.namespace1.cluster.local.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeNameError,
+			Ns:    []dns.RR{k.soa("cluster.local.")},
+		},
+		{
+			Qname: "_http._tcp.1-2-3-4.namespace1.cluster.local.", Qtype: dns.TypeSRV,
+			Rcode: dns.RcodeSuccess,
+			Answer: []dns.RR{
+				test.SRV("_http._tcp.1-2-3-4.namespace1.cluster.local.	5	IN	SRV	0 100 80 1-2-3-4.namespace1.cluster.local."),
+			},
+			Extra: []dns.RR{
+				test.A("1-2-3-4.namespace1.cluster.local.	5	IN	A	1.2.3.4"),
+				test.A("1-2-3-4.namespace1.cluster.local.	5	IN	A	5.6.7.8"),
+				test.AAAA("1-2-3-4.namespace1.cluster.local.	5	IN	AAAA	1:2:3::4"),
+				test.AAAA("1-2-3-4.namespace1.cluster.local.	5	IN	AAAA	5:6:7::8"),
+			},
+		},
+		{
+			Qname: "_dns._udp.1-2-3-4.namespace1.cluster.local.", Qtype: dns.TypeSRV,
+			Rcode: dns.RcodeSuccess,
+			Answer: []dns.RR{
+				test.SRV("_dns._udp.1-2-3-4.namespace1.cluster.local.	5	IN	SRV	0 100 53 1-2-3-4.namespace1.cluster.local."),
+			},
+			Extra: []dns.RR{
+				test.A("1-2-3-4.namespace1.cluster.local.	5	IN	A	1.2.3.4"),
+				test.A("1-2-3-4.namespace1.cluster.local.	5	IN	A	5.6.7.8"),
+				test.AAAA("1-2-3-4.namespace1.cluster.local.	5	IN	AAAA	1:2:3::4"),
+				test.AAAA("1-2-3-4.namespace1.cluster.local.	5	IN	AAAA	5:6:7::8"),
+			},
+		},
+		{
+			Qname: "_http._tcp.1-2-3-4.namespace1.cluster.local.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeSuccess,
+			Ns:    []dns.RR{k.soa("cluster.local.")},
+		},
+		{
+			Qname: "_http._udp.1-2-3-4.namespace1.cluster.local.", Qtype: dns.TypeSRV,
+			Rcode: dns.RcodeNameError,
+			Ns:    []dns.RR{k.soa("cluster.local.")},
 		},
 		{
 			Qname: "cluster.local.", Qtype: dns.TypeA,
 			Rcode: dns.RcodeSuccess,
-			Ns:    []dns.RR{k.soa()},
+			Ns:    []dns.RR{k.soa("cluster.local.")},
 		},
 		{
 			Qname: "namespace1.cluster.local.", Qtype: dns.TypeA,
 			Rcode: dns.RcodeSuccess,
-			Ns:    []dns.RR{k.soa()},
+			Ns:    []dns.RR{k.soa("cluster.local.")},
 		},
 		{
 			Qname: "nonexistent-namespace.cluster.local.", Qtype: dns.TypeA,
 			Rcode: dns.RcodeNameError,
-			Ns:    []dns.RR{k.soa()},
+			Ns:    []dns.RR{k.soa("cluster.local.")},
 		},
 		{
 			Qname: "nonexistent-pod.nonexistent-namespace.cluster.local.", Qtype: dns.TypeA,
 			Rcode: dns.RcodeNameError,
-			Ns:    []dns.RR{k.soa()},
+			Ns:    []dns.RR{k.soa("cluster.local.")},
 		},
 		{
 			Qname: "nonexistent-pod.nonexistent-namespace.cluster.local.", Qtype: dns.TypeMX,
 			Rcode: dns.RcodeNameError,
-			Ns:    []dns.RR{k.soa()},
+			Ns:    []dns.RR{k.soa("cluster.local.")},
 		},
 	}
 
@@ -252,32 +350,53 @@ func TestServeDNSModeNameAndIP(t *testing.T) {
 		{
 			Qname: "1-2-3-5.namespace1.cluster.local.", Qtype: dns.TypeA,
 			Rcode: dns.RcodeNameError,
-			Ns:    []dns.RR{k.soa()},
+			Ns:    []dns.RR{k.soa("cluster.local.")},
+		},
+		{
+			Qname: "host3.sub3.namespace1.cluster.local.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeSuccess,
+			Answer: []dns.RR{
+				test.A("host3.sub3.namespace1.cluster.local.	5	IN	A	10.0.0.3"),
+			},
+		},
+		{
+			Qname: "host3.nonexistent-sub.namespace1.cluster.local.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeNameError,
+			Ns:    []dns.RR{k.soa("cluster.local.")},
+		},
+		{
+			Qname: "3.0.0.10.in-addr.arpa.", Qtype: dns.TypePTR,
+			Rcode: dns.RcodeSuccess,
+			Answer: []dns.RR{
+				test.PTR("3.0.0.10.in-addr.arpa.	5	IN	PTR	10-0-0-3.namespace1.cluster.local."),
+				test.PTR("3.0.0.10.in-addr.arpa.	5	IN	PTR	host3.sub3.namespace1.cluster.local."),
+				test.PTR("3.0.0.10.in-addr.arpa.	5	IN	PTR	pod3.namespace1.cluster.local."),
+			},
 		},
 		{
 			Qname: "cluster.local.", Qtype: dns.TypeA,
 			Rcode: dns.RcodeSuccess,
-			Ns:    []dns.RR{k.soa()},
+			Ns:    []dns.RR{k.soa("cluster.local.")},
 		},
 		{
 			Qname: "namespace1.cluster.local.", Qtype: dns.TypeA,
 			Rcode: dns.RcodeSuccess,
-			Ns:    []dns.RR{k.soa()},
+			Ns:    []dns.RR{k.soa("cluster.local.")},
 		},
 		{
 			Qname: "nonexistent-namespace.cluster.local.", Qtype: dns.TypeA,
 			Rcode: dns.RcodeNameError,
-			Ns:    []dns.RR{k.soa()},
+			Ns:    []dns.RR{k.soa("cluster.local.")},
 		},
 		{
 			Qname: "nonexistent-pod.nonexistent-namespace.cluster.local.", Qtype: dns.TypeA,
 			Rcode: dns.RcodeNameError,
-			Ns:    []dns.RR{k.soa()},
+			Ns:    []dns.RR{k.soa("cluster.local.")},
 		},
 		{
 			Qname: "nonexistent-pod.nonexistent-namespace.cluster.local.", Qtype: dns.TypeMX,
 			Rcode: dns.RcodeNameError,
-			Ns:    []dns.RR{k.soa()},
+			Ns:    []dns.RR{k.soa("cluster.local.")},
 		},
 	}
 
@@ -326,12 +445,12 @@ func TestServeDNSModeEchoIP(t *testing.T) {
 		{
 			Qname: "4.3.2.1.in-addr.arpa.", Qtype: dns.TypePTR,
 			Rcode: dns.RcodeNameError,
-			Ns:    []dns.RR{k.soa()},
+			Ns:    []dns.RR{k.soa("in-addr.arpa.")},
 		},
 		{
 			Qname: "4.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.3.0.0.0.2.0.0.0.1.0.0.0.ip6.arpa.", Qtype: dns.TypePTR,
 			Rcode: dns.RcodeNameError,
-			Ns:    []dns.RR{k.soa()},
+			Ns:    []dns.RR{k.soa("ip6.arpa.")},
 		},
 		{
 			Qname: "1-2-3-5.namespace1.cluster.local.", Qtype: dns.TypeA,
@@ -342,36 +461,779 @@ func TestServeDNSModeEchoIP(t *testing.T) {
 		{
 			Qname: "pod1.namespace1.cluster.local.", Qtype: dns.TypeA,
 			Rcode: dns.RcodeNameError,
-			Ns:    []dns.RR{k.soa()},
+			Ns:    []dns.RR{k.soa("cluster.local.")},
+		},
+		{
+			Qname: "_http._tcp.1-2-3-4.namespace1.cluster.local.", Qtype: dns.TypeSRV,
+			Rcode: dns.RcodeNameError,
+			Ns:    []dns.RR{k.soa("cluster.local.")},
 		},
 		{
 			Qname: "cluster.local.", Qtype: dns.TypeA,
 			Rcode: dns.RcodeSuccess,
-			Ns:    []dns.RR{k.soa()},
+			Ns:    []dns.RR{k.soa("cluster.local.")},
 		},
 		{
 			Qname: "namespace1.cluster.local.", Qtype: dns.TypeA,
 			Rcode: dns.RcodeSuccess,
-			Ns:    []dns.RR{k.soa()},
+			Ns:    []dns.RR{k.soa("cluster.local.")},
 		},
 		{
 			Qname: "nonexistent-namespace.cluster.local.", Qtype: dns.TypeA,
 			Rcode: dns.RcodeSuccess,
-			Ns:    []dns.RR{k.soa()},
+			Ns:    []dns.RR{k.soa("cluster.local.")},
 		},
 		{
 			Qname: "nonexistent-pod.nonexistent-namespace.cluster.local.", Qtype: dns.TypeA,
 			Rcode: dns.RcodeNameError,
-			Ns:    []dns.RR{k.soa()},
+			Ns:    []dns.RR{k.soa("cluster.local.")},
 		},
 		{
 			Qname: "nonexistent-pod.nonexistent-namespace.cluster.local.", Qtype: dns.TypeMX,
 			Rcode: dns.RcodeNameError,
-			Ns:    []dns.RR{k.soa()},
+			Ns:    []dns.RR{k.soa("cluster.local.")},
+		},
+	}
+
+	ctx := context.Background()
+	runTests(t, ctx, k, externalCases)
+
+	k.ignoreNamespaces["namespace2"] = true
+	runTests(t, ctx, k, []test.Case{
+		{
+			Qname: "5-6-7-10.namespace2.cluster.local.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeNameError,
+			Ns:    []dns.RR{k.soa("cluster.local.")},
+		},
+		{
+			Qname: "namespace2.cluster.local.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeNameError,
+			Ns:    []dns.RR{k.soa("cluster.local.")},
+		},
+	})
+}
+
+func TestServeDNSModeTemplate(t *testing.T) {
+	k := New([]string{"cluster.local.", "in-addr.arpa.", "ip6.arpa."})
+	k.mode = modeTemplate
+	var err error
+	k.template, err = parseTemplate(`{{ with index .Labels "app" }}{{ . }}-{{ ordinal $.Pod }}.{{ $.Namespace }}{{ end }}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var externalCases = []test.Case{
+		{
+			Qname: "web-0.namespace1.cluster.local.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeSuccess,
+			Answer: []dns.RR{
+				test.A("web-0.namespace1.cluster.local.	5	IN	A	10.0.0.3"),
+			},
+		},
+		{
+			Qname: "web-0.namespace1.cluster.local.", Qtype: dns.TypeAAAA,
+			Rcode: dns.RcodeSuccess,
+			Ns:    []dns.RR{k.soa("cluster.local.")},
+		},
+		{
+			Qname: "3.0.0.10.in-addr.arpa.", Qtype: dns.TypePTR,
+			Rcode: dns.RcodeSuccess,
+			Answer: []dns.RR{
+				test.PTR("3.0.0.10.in-addr.arpa.	5	IN	PTR	web-0.namespace1.cluster.local."),
+			},
+		},
+		{
+			Qname: "4.3.2.1.in-addr.arpa.", Qtype: dns.TypePTR,
+			Rcode: dns.RcodeNameError,
+			Ns:    []dns.RR{k.soa("in-addr.arpa.")},
+		},
+		{
+			Qname: "pod3.namespace1.cluster.local.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeNameError,
+			Ns:    []dns.RR{k.soa("cluster.local.")},
+		},
+		{
+			// empty non-terminal of the template names
+			Qname: "namespace1.cluster.local.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeSuccess,
+			Ns:    []dns.RR{k.soa("cluster.local.")},
+		},
+		{
+			Qname: "web-1.namespace1.cluster.local.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeNameError,
+			Ns:    []dns.RR{k.soa("cluster.local.")},
+		},
+	}
+
+	k.client = fake.NewSimpleClientset()
+	ctx := context.Background()
+	addFixtures(ctx, k)
+
+	k.setWatch(ctx)
+	go k.controller.Run(k.stopCh)
+	defer close(k.stopCh)
+
+	// quick and dirty wait for sync
+	for !k.controller.HasSynced() {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	runTests(t, ctx, k, externalCases)
+}
+
+func TestServeDNSZoneModes(t *testing.T) {
+	k := New([]string{"cluster.local.", "legacy.local.", "echo.local.", "in-addr.arpa."})
+	k.mode = modeName
+	k.zoneModes["legacy.local."] = modeIP
+	k.zoneModes["echo.local."] = modeEchoIP
+
+	var externalCases = []test.Case{
+		{
+			Qname: "pod1.namespace1.cluster.local.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeSuccess,
+			Answer: []dns.RR{
+				test.A("pod1.namespace1.cluster.local.	5	IN	A	1.2.3.4"),
+				test.A("pod1.namespace1.cluster.local.	5	IN	A	5.6.7.8"),
+			},
+		},
+		{
+			Qname: "1-2-3-4.namespace1.cluster.local.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeNameError,
+			Ns:    []dns.RR{k.soa("cluster.local.")},
+		},
+		{
+			Qname: "1-2-3-4.namespace1.legacy.local.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeSuccess,
+			Answer: []dns.RR{
+				test.A("1-2-3-4.namespace1.legacy.local.	5	IN	A	1.2.3.4"),
+				test.A("1-2-3-4.namespace1.legacy.local.	5	IN	A	5.6.7.8"),
+			},
+		},
+		{
+			Qname: "pod1.namespace1.legacy.local.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeNameError,
+			Ns:    []dns.RR{k.soa("legacy.local.")},
+		},
+		{
+			Qname: "9-9-9-9.namespace1.echo.local.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeSuccess,
+			Answer: []dns.RR{
+				test.A("9-9-9-9.namespace1.echo.local.	5	IN	A	9.9.9.9"),
+			},
+		},
+		{
+			Qname: "3.0.0.10.in-addr.arpa.", Qtype: dns.TypePTR,
+			Rcode: dns.RcodeSuccess,
+			Answer: []dns.RR{
+				test.PTR("3.0.0.10.in-addr.arpa.	5	IN	PTR	10-0-0-3.namespace1.legacy.local."),
+				test.PTR("3.0.0.10.in-addr.arpa.	5	IN	PTR	host3.sub3.namespace1.cluster.local."),
+				test.PTR("3.0.0.10.in-addr.arpa.	5	IN	PTR	pod3.namespace1.cluster.local."),
+			},
+		},
+	}
+
+	k.client = fake.NewSimpleClientset()
+	ctx := context.Background()
+	addFixtures(ctx, k)
+
+	// the unsynced and stale policies only apply to the zones answered from the cache
+	k.unsynced = unsyncedServfail
+	k.stalePolicy = staleFail
+	k.health = []*watchHealth{{failing: time.Now().Add(-time.Hour).UnixNano()}}
+	for _, policy := range []string{"unsynced", "stale"} {
+		for qname, expect := range map[string]int{
+			"1-2-3-4.namespace1.echo.local.": dns.RcodeSuccess,
+			"pod1.namespace1.cluster.local.": dns.RcodeServerFailure,
+			"4.3.2.1.in-addr.arpa.":          dns.RcodeServerFailure,
+		} {
+			r := new(dns.Msg)
+			r.SetQuestion(qname, dns.TypeA)
+			if rcode, _ := k.ServeDNS(ctx, dnstest.NewRecorder(&test.ResponseWriter{}), r); rcode != expect {
+				t.Errorf("Expected rcode %d for %s while %s, got %d", expect, qname, policy, rcode)
+			}
+		}
+		k.unsynced = unsyncedServe
+	}
+	k.stalePolicy = staleIgnore
+
+	k.setWatch(ctx)
+	go k.controller.Run(k.stopCh)
+	defer close(k.stopCh)
+
+	// quick and dirty wait for sync
+	for !k.controller.HasSynced() {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	runTests(t, ctx, k, externalCases)
+
+	if _, err := k.Transfer("echo.local.", 0); err == nil {
+		t.Error("Expected error for a transfer of the zone in echo-ip mode")
+	}
+	axfr := transferRecords(t, k, "legacy.local.", 0)
+	checkTransfer(t, axfr, []string{
+		"1-2-3-4.namespace1.legacy.local.	5	IN	A	1.2.3.4",
+		"10-0-0-3.namespace1.legacy.local.	5	IN	A	10.0.0.3",
+	})
+}
+
+func TestServeDNSPTRZone(t *testing.T) {
+	tests := []struct {
+		ptrZone   string
+		canonical bool
+		targets   []string
+	}{
+		{"", false, []string{
+			"10-0-0-3.namespace1.cluster.local.",
+			"10-0-0-3.namespace1.legacy.local.",
+			"host3.sub3.namespace1.cluster.local.",
+			"pod3.namespace1.cluster.local.",
+		}},
+		{"legacy.local.", false, []string{"10-0-0-3.namespace1.legacy.local."}},
+		{"cluster.local.", false, []string{
+			"10-0-0-3.namespace1.cluster.local.",
+			"host3.sub3.namespace1.cluster.local.",
+			"pod3.namespace1.cluster.local.",
+		}},
+		{"cluster.local.", true, []string{"pod3.namespace1.cluster.local."}},
+		{"", true, []string{"pod3.namespace1.cluster.local."}},
+	}
+
+	for i, tc := range tests {
+		// the reverse zone is first, it is never used for PTR targets
+		k := New([]string{"in-addr.arpa.", "cluster.local.", "legacy.local."})
+		k.mode = modeNameAndIP
+		k.zoneModes["legacy.local."] = modeIP
+		k.ptrZone = tc.ptrZone
+		k.ptrCanonical = tc.canonical
+
+		k.client = fake.NewSimpleClientset()
+		ctx := context.Background()
+		addFixtures(ctx, k)
+		k.setWatch(ctx)
+		go k.controller.Run(k.stopCh)
+		for !k.controller.HasSynced() {
+			time.Sleep(100 * time.Millisecond)
+		}
+
+		var answer []dns.RR
+		for _, target := range tc.targets {
+			answer = append(answer, test.PTR("3.0.0.10.in-addr.arpa.	5	IN	PTR	"+target))
+		}
+		t.Logf("Test %d: ptr_zone %q, canonical %v", i, tc.ptrZone, tc.canonical)
+		runTests(t, ctx, k, []test.Case{{
+			Qname: "3.0.0.10.in-addr.arpa.", Qtype: dns.TypePTR,
+			Rcode:  dns.RcodeSuccess,
+			Answer: answer,
+		}})
+		close(k.stopCh)
+	}
+}
+
+func TestServeDNSDottedNames(t *testing.T) {
+	k := New([]string{"cluster.local.", "in-addr.arpa."})
+	k.mode = modeNameAndIP
+	k.client = fake.NewSimpleClientset()
+	ctx := context.Background()
+	addFixtures(ctx, k)
+	k.client.CoreV1().Pods("namespace1").Create(ctx, &core.Pod{
+		ObjectMeta: meta.ObjectMeta{Name: "web.app.v1", Namespace: "namespace1"},
+		Spec: core.PodSpec{
+			Containers: []core.Container{{Name: "web", Ports: []core.ContainerPort{{Name: "http", ContainerPort: 80}}}},
+		},
+		Status: core.PodStatus{PodIPs: []core.PodIP{{IP: "10.0.0.9"}}},
+	}, meta.CreateOptions{})
+
+	k.setWatch(ctx)
+	go k.controller.Run(k.stopCh)
+	defer close(k.stopCh)
+
+	// quick and dirty wait for sync
+	for !k.controller.HasSynced() {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	runTests(t, ctx, k, []test.Case{
+		{
+			Qname: "web.app.v1.namespace1.cluster.local.", Qtype: dns.TypeA,
+			Rcode:  dns.RcodeSuccess,
+			Answer: []dns.RR{test.A("web.app.v1.namespace1.cluster.local.	5	IN	A	10.0.0.9")},
+		},
+		{
+			Qname: "_http._tcp.web.app.v1.namespace1.cluster.local.", Qtype: dns.TypeSRV,
+			Rcode:  dns.RcodeSuccess,
+			Answer: []dns.RR{test.SRV("_http._tcp.web.app.v1.namespace1.cluster.local.	5	IN	SRV	0 100 80 web.app.v1.namespace1.cluster.local.")},
+			Extra:  []dns.RR{test.A("web.app.v1.namespace1.cluster.local.	5	IN	A	10.0.0.9")},
+		},
+		{
+			Qname: "9.0.0.10.in-addr.arpa.", Qtype: dns.TypePTR,
+			Rcode: dns.RcodeSuccess,
+			Answer: []dns.RR{
+				test.PTR("9.0.0.10.in-addr.arpa.	5	IN	PTR	10-0-0-9.namespace1.cluster.local."),
+				test.PTR("9.0.0.10.in-addr.arpa.	5	IN	PTR	web.app.v1.namespace1.cluster.local."),
+			},
+		},
+		{
+			// empty non-terminals of the Pod's name
+			Qname: "app.v1.namespace1.cluster.local.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeSuccess,
+			Ns:    []dns.RR{k.soa("cluster.local.")},
+		},
+		{
+			Qname: "v1.namespace1.cluster.local.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeSuccess,
+			Ns:    []dns.RR{k.soa("cluster.local.")},
+		},
+		{
+			Qname: "v1.namespace2.cluster.local.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeNameError,
+			Ns:    []dns.RR{k.soa("cluster.local.")},
+		},
+		{
+			Qname: "x.web.app.v1.namespace1.cluster.local.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeNameError,
+			Ns:    []dns.RR{k.soa("cluster.local.")},
+		},
+		{
+			Qname: "host3.sub3.namespace1.cluster.local.", Qtype: dns.TypeA,
+			Rcode:  dns.RcodeSuccess,
+			Answer: []dns.RR{test.A("host3.sub3.namespace1.cluster.local.	5	IN	A	10.0.0.3")},
+		},
+	})
+
+	// a Pod that isn't served doesn't hide the empty non-terminal of a served Pod's name
+	running := New([]string{"cluster.local."})
+	running.mode = modeName
+	running.serve = serveRunning
+	running.client = fake.NewSimpleClientset()
+	for _, pod := range []*core.Pod{
+		{
+			ObjectMeta: meta.ObjectMeta{Name: "b", Namespace: "ns"},
+			Status:     core.PodStatus{Phase: core.PodPending, PodIPs: []core.PodIP{{IP: "10.0.1.1"}}},
+		},
+		{
+			ObjectMeta: meta.ObjectMeta{Name: "a.b", Namespace: "ns"},
+			Status:     core.PodStatus{Phase: core.PodRunning, PodIPs: []core.PodIP{{IP: "10.0.1.2"}}},
+		},
+	} {
+		running.client.CoreV1().Pods(pod.Namespace).Create(ctx, pod, meta.CreateOptions{})
+	}
+	running.setWatch(ctx)
+	go running.controller.Run(running.stopCh)
+	defer close(running.stopCh)
+	for !running.controller.HasSynced() {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	runTests(t, ctx, running, []test.Case{
+		{
+			Qname: "b.ns.cluster.local.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeSuccess,
+			Ns:    []dns.RR{running.soa("cluster.local.")},
+		},
+		{
+			Qname: "a.b.ns.cluster.local.", Qtype: dns.TypeA,
+			Rcode:  dns.RcodeSuccess,
+			Answer: []dns.RR{test.A("a.b.ns.cluster.local.	5	IN	A	10.0.1.2")},
+		},
+	})
+}
+
+func TestServeDNSNegative(t *testing.T) {
+	k := New([]string{"cluster.local.", "in-addr.arpa.", "ip6.arpa."})
+	k.mode = modeNameAndIP
+
+	var externalCases = []test.Case{
+		{
+			Qname: "cluster.local.", Qtype: dns.TypeSOA,
+			Rcode:  dns.RcodeSuccess,
+			Answer: []dns.RR{k.soa("cluster.local.")},
+		},
+		{
+			Qname: "cluster.local.", Qtype: dns.TypeNS,
+			Rcode:  dns.RcodeSuccess,
+			Answer: []dns.RR{test.NS("cluster.local.	5	IN	NS	ns.dns.cluster.local.")},
+		},
+		{
+			Qname: "in-addr.arpa.", Qtype: dns.TypeSOA,
+			Rcode:  dns.RcodeSuccess,
+			Answer: []dns.RR{k.soa("in-addr.arpa.")},
+		},
+		{
+			Qname: "cluster.local.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeSuccess,
+			Ns:    []dns.RR{k.soa("cluster.local.")},
+		},
+		{
+			Qname: "pod1.namespace1.cluster.local.", Qtype: dns.TypeMX,
+			Rcode: dns.RcodeSuccess,
+			Ns:    []dns.RR{k.soa("cluster.local.")},
+		},
+		{
+			Qname: "host3.sub3.namespace1.cluster.local.", Qtype: dns.TypeTXT,
+			Rcode: dns.RcodeSuccess,
+			Ns:    []dns.RR{k.soa("cluster.local.")},
+		},
+		{
+			Qname: "sub3.namespace1.cluster.local.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeSuccess,
+			Ns:    []dns.RR{k.soa("cluster.local.")},
+		},
+		{
+			Qname: "ns.dns.cluster.local.", Qtype: dns.TypeA,
+			Rcode:  dns.RcodeSuccess,
+			Answer: []dns.RR{test.A("ns.dns.cluster.local.	5	IN	A	127.0.0.1")},
+		},
+		{
+			Qname: "ns.dns.in-addr.arpa.", Qtype: dns.TypeAAAA,
+			Rcode: dns.RcodeSuccess,
+			Ns:    []dns.RR{k.soa("in-addr.arpa.")},
+		},
+		{
+			Qname: "_tcp.1-2-3-4.namespace1.cluster.local.", Qtype: dns.TypeSRV,
+			Rcode: dns.RcodeSuccess,
+			Ns:    []dns.RR{k.soa("cluster.local.")},
+		},
+		{
+			Qname: "_udp.pod1.namespace1.cluster.local.", Qtype: dns.TypeSRV,
+			Rcode: dns.RcodeSuccess,
+			Ns:    []dns.RR{k.soa("cluster.local.")},
+		},
+		{
+			Qname: "_sctp.pod1.namespace1.cluster.local.", Qtype: dns.TypeSRV,
+			Rcode: dns.RcodeNameError,
+			Ns:    []dns.RR{k.soa("cluster.local.")},
+		},
+		{
+			Qname: "1-2-3-4.namespace1.cluster.local.", Qtype: dns.TypePTR,
+			Rcode: dns.RcodeSuccess,
+			Ns:    []dns.RR{k.soa("cluster.local.")},
+		},
+		{
+			Qname: "namespace1.cluster.local.", Qtype: dns.TypePTR,
+			Rcode: dns.RcodeSuccess,
+			Ns:    []dns.RR{k.soa("cluster.local.")},
+		},
+		{
+			Qname: "pod9.namespace1.cluster.local.", Qtype: dns.TypePTR,
+			Rcode: dns.RcodeNameError,
+			Ns:    []dns.RR{k.soa("cluster.local.")},
+		},
+		{
+			Qname: "4.3.2.1.in-addr.arpa.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeSuccess,
+			Ns:    []dns.RR{k.soa("in-addr.arpa.")},
+		},
+		{
+			Qname: "3.2.1.in-addr.arpa.", Qtype: dns.TypePTR,
+			Rcode: dns.RcodeSuccess,
+			Ns:    []dns.RR{k.soa("in-addr.arpa.")},
+		},
+		{
+			Qname: "1.in-addr.arpa.", Qtype: dns.TypePTR,
+			Rcode: dns.RcodeSuccess,
+			Ns:    []dns.RR{k.soa("in-addr.arpa.")},
+		},
+		{
+			Qname: "0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.3.0.0.0.2.0.0.0.1.0.0.0.ip6.arpa.", Qtype: dns.TypePTR,
+			Rcode: dns.RcodeSuccess,
+			Ns:    []dns.RR{k.soa("ip6.arpa.")},
+		},
+		{
+			Qname: "9.2.1.in-addr.arpa.", Qtype: dns.TypePTR,
+			Rcode: dns.RcodeNameError,
+			Ns:    []dns.RR{k.soa("in-addr.arpa.")},
+		},
+		{
+			Qname: "x.4.3.2.1.in-addr.arpa.", Qtype: dns.TypePTR,
+			Rcode: dns.RcodeNameError,
+			Ns:    []dns.RR{k.soa("in-addr.arpa.")},
+		},
+	}
+
+	k.client = fake.NewSimpleClientset()
+	ctx := context.Background()
+	addFixtures(ctx, k)
+
+	k.setWatch(ctx)
+	go k.controller.Run(k.stopCh)
+	defer close(k.stopCh)
+
+	// quick and dirty wait for sync
+	for !k.controller.HasSynced() {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	runTests(t, ctx, k, externalCases)
+}
+
+func TestServeDNSServePolicy(t *testing.T) {
+	tests := []struct {
+		serve int
+		cases []test.Case
+	}{
+		{
+			serve: serveRunning,
+			cases: []test.Case{
+				{
+					Qname: "ready.namespace1.cluster.local.", Qtype: dns.TypeA,
+					Rcode:  dns.RcodeSuccess,
+					Answer: []dns.RR{test.A("ready.namespace1.cluster.local.	5	IN	A	10.0.1.1")},
+				},
+				{
+					Qname: "running.namespace1.cluster.local.", Qtype: dns.TypeA,
+					Rcode:  dns.RcodeSuccess,
+					Answer: []dns.RR{test.A("running.namespace1.cluster.local.	5	IN	A	10.0.1.2")},
+				},
+				{
+					Qname: "done.namespace1.cluster.local.", Qtype: dns.TypeA,
+					Rcode: dns.RcodeNameError,
+					Ns:    []dns.RR{test.SOA("cluster.local.	5	IN	SOA	ns.dns.cluster.local. hostmaster.dns.cluster.local. 0 7200 1800 86400 5")},
+				},
+				{
+					Qname: "3.1.0.10.in-addr.arpa.", Qtype: dns.TypePTR,
+					Rcode: dns.RcodeNameError,
+					Ns:    []dns.RR{test.SOA("in-addr.arpa.	5	IN	SOA	ns.dns.in-addr.arpa. hostmaster.dns.in-addr.arpa. 0 7200 1800 86400 5")},
+				},
+			},
+		},
+		{
+			serve: serveReady,
+			cases: []test.Case{
+				{
+					Qname: "ready.namespace1.cluster.local.", Qtype: dns.TypeA,
+					Rcode:  dns.RcodeSuccess,
+					Answer: []dns.RR{test.A("ready.namespace1.cluster.local.	5	IN	A	10.0.1.1")},
+				},
+				{
+					Qname: "1.1.0.10.in-addr.arpa.", Qtype: dns.TypePTR,
+					Rcode:  dns.RcodeSuccess,
+					Answer: []dns.RR{test.PTR("1.1.0.10.in-addr.arpa.	5	IN	PTR	ready.namespace1.cluster.local.")},
+				},
+				{
+					Qname: "running.namespace1.cluster.local.", Qtype: dns.TypeA,
+					Rcode: dns.RcodeNameError,
+					Ns:    []dns.RR{test.SOA("cluster.local.	5	IN	SOA	ns.dns.cluster.local. hostmaster.dns.cluster.local. 0 7200 1800 86400 5")},
+				},
+				{
+					Qname: "2.1.0.10.in-addr.arpa.", Qtype: dns.TypePTR,
+					Rcode: dns.RcodeNameError,
+					Ns:    []dns.RR{test.SOA("in-addr.arpa.	5	IN	SOA	ns.dns.in-addr.arpa. hostmaster.dns.in-addr.arpa. 0 7200 1800 86400 5")},
+				},
+				{
+					Qname: "namespace2.cluster.local.", Qtype: dns.TypeA,
+					Rcode: dns.RcodeNameError,
+					Ns:    []dns.RR{test.SOA("cluster.local.	5	IN	SOA	ns.dns.cluster.local. hostmaster.dns.cluster.local. 0 7200 1800 86400 5")},
+				},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		k := New([]string{"cluster.local.", "in-addr.arpa.", "ip6.arpa."})
+		k.mode = modeName
+		k.serve = tc.serve
+		k.client = fake.NewSimpleClientset()
+		ctx := context.Background()
+
+		pods := []*core.Pod{
+			{
+				ObjectMeta: meta.ObjectMeta{Name: "ready", Namespace: "namespace1"},
+				Status: core.PodStatus{
+					Phase:      core.PodRunning,
+					Conditions: []core.PodCondition{{Type: core.PodReady, Status: core.ConditionTrue}},
+					PodIPs:     []core.PodIP{{IP: "10.0.1.1"}},
+				},
+			},
+			{
+				ObjectMeta: meta.ObjectMeta{Name: "running", Namespace: "namespace1"},
+				Status: core.PodStatus{
+					Phase:      core.PodRunning,
+					Conditions: []core.PodCondition{{Type: core.PodReady, Status: core.ConditionFalse}},
+					PodIPs:     []core.PodIP{{IP: "10.0.1.2"}},
+				},
+			},
+			{
+				ObjectMeta: meta.ObjectMeta{Name: "done", Namespace: "namespace1"},
+				Status: core.PodStatus{
+					Phase:  core.PodSucceeded,
+					PodIPs: []core.PodIP{{IP: "10.0.1.3"}},
+				},
+			},
+			{
+				ObjectMeta: meta.ObjectMeta{Name: "pending", Namespace: "namespace2"},
+				Status: core.PodStatus{
+					Phase:  core.PodPending,
+					PodIPs: []core.PodIP{{IP: "10.0.1.4"}},
+				},
+			},
+		}
+		for _, pod := range pods {
+			k.client.CoreV1().Pods(pod.Namespace).Create(ctx, pod, meta.CreateOptions{})
+		}
+
+		k.setWatch(ctx)
+		go k.controller.Run(k.stopCh)
+
+		// quick and dirty wait for sync
+		for !k.controller.HasSynced() {
+			time.Sleep(100 * time.Millisecond)
+		}
+
+		runTests(t, ctx, k, tc.cases)
+		close(k.stopCh)
+	}
+}
+
+func TestServeDNSPodSelection(t *testing.T) {
+	nxdomain := func(qname string) test.Case {
+		return test.Case{
+			Qname: qname, Qtype: dns.TypeA,
+			Rcode: dns.RcodeNameError,
+			Ns:    []dns.RR{test.SOA("cluster.local.	5	IN	SOA	ns.dns.cluster.local. hostmaster.dns.cluster.local. 0 7200 1800 86400 5")},
+		}
+	}
+	pod1 := test.Case{
+		Qname: "pod1.namespace1.cluster.local.", Qtype: dns.TypeA,
+		Rcode: dns.RcodeSuccess,
+		Answer: []dns.RR{
+			test.A("pod1.namespace1.cluster.local.	5	IN	A	1.2.3.4"),
+			test.A("pod1.namespace1.cluster.local.	5	IN	A	5.6.7.8"),
+		},
+	}
+	pod3 := test.Case{
+		Qname: "pod3.namespace1.cluster.local.", Qtype: dns.TypeA,
+		Rcode:  dns.RcodeSuccess,
+		Answer: []dns.RR{test.A("pod3.namespace1.cluster.local.	5	IN	A	10.0.0.3")},
+	}
+
+	tests := []struct {
+		namespaces       []string
+		ignoreNamespaces []string
+		labels           string
+		node             string
+		cases            []test.Case
+	}{
+		{
+			namespaces: []string{"namespace1"},
+			cases:      []test.Case{pod1, pod3, nxdomain("pod2.namespace2.cluster.local."), nxdomain("namespace2.cluster.local.")},
+		},
+		{
+			namespaces: []string{"namespace1", "namespace3"},
+			cases:      []test.Case{pod1, nxdomain("pod2.namespace2.cluster.local.")},
+		},
+		{
+			ignoreNamespaces: []string{"namespace2"},
+			cases:            []test.Case{pod1, nxdomain("pod2.namespace2.cluster.local.")},
+		},
+		{
+			labels: "app=web",
+			cases:  []test.Case{pod3, nxdomain("pod1.namespace1.cluster.local."), nxdomain("pod2.namespace2.cluster.local.")},
+		},
+		{
+			node:  "node1",
+			cases: []test.Case{pod1, nxdomain("pod3.namespace1.cluster.local."), nxdomain("pod2.namespace2.cluster.local.")},
 		},
 	}
 
+	for _, tc := range tests {
+		k := New([]string{"cluster.local.", "in-addr.arpa.", "ip6.arpa."})
+		k.mode = modeName
+		for _, ns := range tc.namespaces {
+			k.namespaces[ns] = true
+		}
+		for _, ns := range tc.ignoreNamespaces {
+			k.ignoreNamespaces[ns] = true
+		}
+		k.node = tc.node
+		if tc.labels != "" {
+			var err error
+			k.labelSelector, err = labels.Parse(tc.labels)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		k.client = fake.NewSimpleClientset()
+		ctx := context.Background()
+		addFixtures(ctx, k)
+
+		k.setWatch(ctx)
+		go k.controller.Run(k.stopCh)
+
+		// quick and dirty wait for sync
+		for !k.controller.HasSynced() {
+			time.Sleep(100 * time.Millisecond)
+		}
+
+		runTests(t, ctx, k, tc.cases)
+		close(k.stopCh)
+	}
+}
+
+func TestServeDNSNamespaced(t *testing.T) {
+	k := New([]string{"cluster.local.", "in-addr.arpa.", "ip6.arpa."})
+	k.mode = modeName
+	k.namespaces["namespace1"] = true
+	k.namespaces["namespace2"] = true
+	k.namespaced = true
+
+	var externalCases = []test.Case{
+		{
+			Qname: "pod1.namespace1.cluster.local.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeSuccess,
+			Answer: []dns.RR{
+				test.A("pod1.namespace1.cluster.local.	5	IN	A	1.2.3.4"),
+				test.A("pod1.namespace1.cluster.local.	5	IN	A	5.6.7.8"),
+			},
+		},
+		{
+			Qname: "pod2.namespace2.cluster.local.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeSuccess,
+			Answer: []dns.RR{
+				test.A("pod2.namespace2.cluster.local.	5	IN	A	5.6.7.10"),
+				test.A("pod2.namespace2.cluster.local.	5	IN	A	5.6.7.9"),
+			},
+		},
+		{
+			Qname: "host3.sub3.namespace1.cluster.local.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeSuccess,
+			Answer: []dns.RR{
+				test.A("host3.sub3.namespace1.cluster.local.	5	IN	A	10.0.0.3"),
+			},
+		},
+		{
+			Qname: "9.7.6.5.in-addr.arpa.", Qtype: dns.TypePTR,
+			Rcode: dns.RcodeSuccess,
+			Answer: []dns.RR{
+				test.PTR("9.7.6.5.in-addr.arpa.	5	IN	PTR	pod2.namespace2.cluster.local."),
+			},
+		},
+		{
+			Qname: "pod1.namespace2.cluster.local.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeNameError,
+			Ns:    []dns.RR{k.soa("cluster.local.")},
+		},
+	}
+
+	k.client = fake.NewSimpleClientset()
 	ctx := context.Background()
+	addFixtures(ctx, k)
+
+	k.setWatch(ctx)
+	if k.Ready() {
+		t.Error("Expected not ready before the informers have synced")
+	}
+	go k.controller.Run(k.stopCh)
+	defer close(k.stopCh)
+
+	// quick and dirty wait for sync
+	for !k.controller.HasSynced() {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if !k.Ready() {
+		t.Error("Expected ready after the informers have synced")
+	}
+
 	runTests(t, ctx, k, externalCases)
 }
 
@@ -382,6 +1244,19 @@ func addFixtures(ctx context.Context, k *KubePods) {
 			Namespace:   "namespace1",
 			Annotations: map[string]string{"foo": "bar", "bar": "foo"},
 		},
+		Spec: core.PodSpec{
+			NodeName: "node1",
+			Containers: []core.Container{
+				{
+					Name: "app",
+					Ports: []core.ContainerPort{
+						{Name: "http", ContainerPort: 80},
+						{Name: "dns", ContainerPort: 53, Protocol: core.ProtocolUDP},
+						{ContainerPort: 8080},
+					},
+				},
+			},
+		},
 		Status: core.PodStatus{
 			PodIPs: []core.PodIP{
 				{IP: "1.2.3.4"},
@@ -403,8 +1278,25 @@ func addFixtures(ctx context.Context, k *KubePods) {
 			},
 		},
 	}
+	pod3 := &core.Pod{
+		ObjectMeta: meta.ObjectMeta{
+			Name:      "pod3",
+			Namespace: "namespace1",
+			Labels:    map[string]string{"app": "web", podIndexLabel: "0"},
+		},
+		Spec: core.PodSpec{
+			Hostname:  "host3",
+			Subdomain: "sub3",
+		},
+		Status: core.PodStatus{
+			PodIPs: []core.PodIP{
+				{IP: "10.0.0.3"},
+			},
+		},
+	}
 	k.client.CoreV1().Pods(pod1.Namespace).Create(ctx, pod1, meta.CreateOptions{})
 	k.client.CoreV1().Pods(pod2.Namespace).Create(ctx, pod2, meta.CreateOptions{})
+	k.client.CoreV1().Pods(pod3.Namespace).Create(ctx, pod3, meta.CreateOptions{})
 }
 
 func runTests(t *testing.T, ctx context.Context, k *KubePods, cases []test.Case) {
@@ -0,0 +1,61 @@
+package kubepods
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+	core "k8s.io/api/core/v1"
+
+	"github.com/coredns/coredns/request"
+)
+
+// labelLabel is the label of label query names, as in value.key.label.namespace.
+const labelLabel = "label"
+
+// parseLabelKey parses a label key of the label_records directive, written as KEY or NAME=KEY.
+// It returns the name of the key in queries, which is KEY if NAME is not given, and the key.
+func parseLabelKey(arg string) (name, key string, err error) {
+	name, key = arg, arg
+	if i := strings.Index(arg, "="); i >= 0 {
+		name, key = arg[:i], arg[i+1:]
+	}
+	if key == "" {
+		return "", "", fmt.Errorf("empty label key in '%s'", arg)
+	}
+	name = strings.ToLower(name)
+	if _, ok := dns.IsDomainName(name); !ok || dns.CountLabel(name) != 1 || strings.Contains(name, "/") {
+		return "", "", fmt.Errorf("label key '%s' is not a DNS label, give it a name with NAME=KEY", name)
+	}
+	return name, key, nil
+}
+
+// queriedLabels returns the values of the labels of pod that can be queried, by the name of their
+// key in queries. The values are lowercase.
+func (k *KubePods) queriedLabels(pod *core.Pod) map[string]string {
+	var labels map[string]string
+	for name, key := range k.labelKeys {
+		value, ok := pod.Labels[key]
+		if !ok || value == "" {
+			continue
+		}
+		if labels == nil {
+			labels = make(map[string]string)
+		}
+		labels[name] = strings.ToLower(value)
+	}
+	return labels
+}
+
+// serveLabel answers queries for value.key.label.namespace names with the addresses of the Pods
+// whose label key has the value. It returns false if there are no such Pods.
+func (k *KubePods) serveLabel(state request.Request, podDomain string) (int, bool, error) {
+	segments := dns.SplitDomainName(podDomain)
+	n := len(segments)
+	if n < 4 || segments[n-2] != labelLabel {
+		return 0, false, nil
+	}
+	// the value can have dots
+	key := strings.Join([]string{segments[n-1], segments[n-3], strings.Join(segments[:n-3], ".")}, "/")
+	return k.serveGroup(state, "label", key)
+}
@@ -0,0 +1,152 @@
+package kubepods
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/coredns/coredns/plugin/test"
+)
+
+func TestParseLabelKey(t *testing.T) {
+	tests := []struct {
+		arg        string
+		name, key  string
+		shouldFail bool
+	}{
+		{"app", "app", "app", false},
+		{"Tier", "tier", "Tier", false},
+		{"name=app.kubernetes.io/name", "name", "app.kubernetes.io/name", false},
+		{"app.kubernetes.io/name", "", "", true},
+		{"a.b=app", "", "", true},
+		{"name=", "", "", true},
+	}
+	for i, tc := range tests {
+		name, key, err := parseLabelKey(tc.arg)
+		if tc.shouldFail {
+			if err == nil {
+				t.Errorf("Test %d: expected error for %q", i, tc.arg)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: unexpected error for %q: %v", i, tc.arg, err)
+			continue
+		}
+		if name != tc.name || key != tc.key {
+			t.Errorf("Test %d: expected %q and %q, got %q and %q", i, tc.name, tc.key, name, key)
+		}
+	}
+}
+
+func TestServeDNSLabels(t *testing.T) {
+	k := New([]string{"cluster.local.", "ip.local."})
+	k.mode = modeName
+	k.zoneModes["ip.local."] = modeIP
+	k.labelKeys["app"] = "app"
+	k.labelKeys["name"] = "app.kubernetes.io/name"
+
+	k.client = fake.NewSimpleClientset()
+	ctx := context.Background()
+	addFixtures(ctx, k)
+	for _, pod := range []*core.Pod{
+		{
+			ObjectMeta: meta.ObjectMeta{Name: "web-1", Namespace: "namespace1", Labels: map[string]string{"app": "Web", "tier": "frontend"}},
+			Status:     core.PodStatus{PodIPs: []core.PodIP{{IP: "10.0.3.1"}, {IP: "fd00::3:1"}}},
+		},
+		{
+			ObjectMeta: meta.ObjectMeta{Name: "api-1", Namespace: "namespace1", Labels: map[string]string{"app.kubernetes.io/name": "api.v2"}},
+			Status:     core.PodStatus{PodIPs: []core.PodIP{{IP: "10.0.3.2"}}},
+		},
+	} {
+		k.client.CoreV1().Pods(pod.Namespace).Create(ctx, pod, meta.CreateOptions{})
+	}
+
+	k.setWatch(ctx)
+	go k.controller.Run(k.stopCh)
+	defer close(k.stopCh)
+
+	// quick and dirty wait for sync
+	for !k.controller.HasSynced() {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	runTests(t, ctx, k, []test.Case{
+		{
+			// pod3 and web-1
+			Qname: "web.app.label.namespace1.cluster.local.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeSuccess,
+			Answer: []dns.RR{
+				test.A("web.app.label.namespace1.cluster.local.	5	IN	A	10.0.0.3"),
+				test.A("web.app.label.namespace1.cluster.local.	5	IN	A	10.0.3.1"),
+			},
+		},
+		{
+			Qname: "web.app.label.namespace1.cluster.local.", Qtype: dns.TypeAAAA,
+			Rcode:  dns.RcodeSuccess,
+			Answer: []dns.RR{test.AAAA("web.app.label.namespace1.cluster.local.	5	IN	AAAA	fd00::3:1")},
+		},
+		{
+			Qname: "api.v2.name.label.namespace1.cluster.local.", Qtype: dns.TypeA,
+			Rcode:  dns.RcodeSuccess,
+			Answer: []dns.RR{test.A("api.v2.name.label.namespace1.cluster.local.	5	IN	A	10.0.3.2")},
+		},
+		{
+			// tier is not in the allowlist
+			Qname: "frontend.tier.label.namespace1.cluster.local.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeNameError,
+			Ns:    []dns.RR{k.soa("cluster.local.")},
+		},
+		{
+			Qname: "web.app.label.namespace2.cluster.local.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeNameError,
+			Ns:    []dns.RR{k.soa("cluster.local.")},
+		},
+		{
+			// empty non-terminals
+			Qname: "app.label.namespace1.cluster.local.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeSuccess,
+			Ns:    []dns.RR{k.soa("cluster.local.")},
+		},
+		{
+			Qname: "v2.name.label.namespace1.cluster.local.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeSuccess,
+			Ns:    []dns.RR{k.soa("cluster.local.")},
+		},
+		{
+			Qname: "web.app.label.namespace1.ip.local.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeSuccess,
+			Answer: []dns.RR{
+				test.A("web.app.label.namespace1.ip.local.	5	IN	A	10.0.0.3"),
+				test.A("web.app.label.namespace1.ip.local.	5	IN	A	10.0.3.1"),
+			},
+		},
+		{
+			// empty non-terminals without Pod names
+			Qname: "app.label.namespace1.ip.local.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeSuccess,
+			Ns:    []dns.RR{k.soa("ip.local.")},
+		},
+		{
+			Qname: "label.namespace1.ip.local.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeSuccess,
+			Ns:    []dns.RR{k.soa("ip.local.")},
+		},
+		{
+			Qname: "tier.label.namespace1.ip.local.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeNameError,
+			Ns:    []dns.RR{k.soa("ip.local.")},
+		},
+	})
+
+	axfr := transferRecords(t, k, "cluster.local.", 0)
+	checkTransfer(t, axfr, []string{
+		"web.app.label.namespace1.cluster.local.	5	IN	A	10.0.0.3",
+		"api.v2.name.label.namespace1.cluster.local.	5	IN	A	10.0.3.2",
+	})
+}
@@ -5,22 +5,16 @@ import (
 
 	"github.com/coredns/coredns/plugin/metadata"
 	"github.com/coredns/coredns/request"
-
-	core "k8s.io/api/core/v1"
 )
 
 // Metadata implements the metadata.Provider interface.
 func (k *KubePods) Metadata(ctx context.Context, state request.Request) context.Context {
-	if k.indexer == nil {
-		return ctx
-	}
-	p, err := k.indexer.ByIndex("reverse", state.IP())
-	if err != nil || len(p) == 0 {
+	if k.echoOnly() {
 		return ctx
 	}
-
-	pod, ok := p[0].(*core.Pod)
-	if !ok {
+	pod, err := k.podByIP(state.IP())
+	metadataLookups.WithLabelValues(lookupResult(err == nil && pod != nil)).Inc()
+	if err != nil || pod == nil {
 		return ctx
 	}
 
@@ -5,6 +5,9 @@ import (
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes/fake"
 
 	"github.com/coredns/coredns/plugin/metadata"
@@ -52,6 +55,60 @@ func TestMetadata(t *testing.T) {
 	}
 }
 
+func TestMetadataIPReuse(t *testing.T) {
+	k := New([]string{"cluster.local.", "in-addr.arpa.", "ip6.arpa."})
+	k.mode = modeName
+	k.client = fake.NewSimpleClientset()
+	ctx := metadata.ContextWithMetadata(context.Background())
+
+	now := time.Now()
+	pods := []*core.Pod{
+		{
+			ObjectMeta: meta.ObjectMeta{Name: "old", Namespace: "namespace1", CreationTimestamp: meta.NewTime(now.Add(-time.Hour))},
+			Status:     core.PodStatus{Phase: core.PodRunning, PodIPs: []core.PodIP{{IP: "10.0.0.1"}}},
+		},
+		{
+			ObjectMeta: meta.ObjectMeta{Name: "new", Namespace: "namespace1", CreationTimestamp: meta.NewTime(now)},
+			Status:     core.PodStatus{Phase: core.PodRunning, PodIPs: []core.PodIP{{IP: "10.0.0.1"}}},
+		},
+		{
+			ObjectMeta: meta.ObjectMeta{Name: "completed", Namespace: "namespace1", CreationTimestamp: meta.NewTime(now.Add(time.Minute))},
+			Status:     core.PodStatus{Phase: core.PodSucceeded, PodIPs: []core.PodIP{{IP: "10.0.0.1"}}},
+		},
+		{
+			ObjectMeta: meta.ObjectMeta{Name: "host", Namespace: "namespace1", CreationTimestamp: meta.NewTime(now.Add(time.Minute))},
+			Spec:       core.PodSpec{HostNetwork: true},
+			Status:     core.PodStatus{Phase: core.PodRunning, PodIPs: []core.PodIP{{IP: "10.0.0.1"}}},
+		},
+	}
+	for _, pod := range pods {
+		k.client.CoreV1().Pods(pod.Namespace).Create(ctx, pod, meta.CreateOptions{})
+	}
+	k.setWatch(ctx)
+	go k.controller.Run(k.stopCh)
+	defer close(k.stopCh)
+	// quick and dirty wait for sync
+	for !k.controller.HasSynced() {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	collisions := testutil.ToFloat64(ipCollisions)
+
+	state := request.Request{
+		Req:  &dns.Msg{Question: []dns.Question{{Name: "example.com.", Qtype: dns.TypeA}}},
+		Zone: ".",
+		W:    &test.ResponseWriter{RemoteIP: "10.0.0.1"},
+	}
+	k.Metadata(ctx, state)
+
+	if name := metadata.ValueFunc(ctx, "kubepods/client-pod-name")(); name != "new" {
+		t.Errorf("Expected client pod name %q, got %q", "new", name)
+	}
+	if c := testutil.ToFloat64(ipCollisions); c != collisions+1 {
+		t.Errorf("Expected %v collisions, got %v", collisions+1, c)
+	}
+}
+
 func mapsDiffer(a, b map[string]string) bool {
 	if len(a) != len(b) {
 		return true
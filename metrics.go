@@ -0,0 +1,146 @@
+package kubepods
+
+import (
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// ipCollisions is the counter of lookups by address that matched more than one Pod.
+	ipCollisions = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "kubepods",
+		Name:      "ip_collisions_total",
+		Help:      "Counter of lookups by address that matched more than one Pod.",
+	})
+	// unsyncedQueries is the counter of queries received before the Pod cache has synced, by outcome.
+	unsyncedQueries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "kubepods",
+		Name:      "unsynced_queries_total",
+		Help:      "Counter of queries received before the Pod cache has synced, by outcome.",
+	}, []string{"outcome"})
+	// watchErrors is the counter of failed lists and watches of Pods, and errors received on watches.
+	watchErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "kubepods",
+		Name:      "watch_errors_total",
+		Help:      "Counter of failed lists and watches of Pods, and errors received on watches.",
+	})
+	// watchLastSuccess is the time of the last successful list, watch or event of Pods.
+	watchLastSuccess = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "kubepods",
+		Name:      "watch_last_success_timestamp_seconds",
+		Help:      "Time of the last successful list, watch or event of Pods.",
+	})
+)
+
+var (
+	// requestCount is the counter of requests answered by the plugin, by the path that answered them.
+	requestCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "kubepods",
+		Name:      "requests_total",
+		Help:      "Counter of requests answered, by query type, rcode and answer path.",
+	}, []string{"server", "type", "rcode", "path"})
+	// requestDuration is the histogram of the time taken to answer requests.
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "kubepods",
+		Name:      "request_duration_seconds",
+		Buckets:   plugin.TimeBuckets,
+		Help:      "Histogram of the time (in seconds) each request took to answer.",
+	}, []string{"server"})
+	// cachedPods is the number of Pods in the cache.
+	cachedPods = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "kubepods",
+		Name:      "pods",
+		Help:      "Number of Pods in the cache.",
+	})
+	// cachedIPs is the number of Pod addresses in the cache.
+	cachedIPs = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "kubepods",
+		Name:      "ips",
+		Help:      "Number of Pod addresses in the cache.",
+	})
+	// podEvents is the counter of Pod events received from the informer.
+	podEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "kubepods",
+		Name:      "pod_events_total",
+		Help:      "Counter of Pod events received, by event.",
+	}, []string{"event"})
+	// metadataLookups is the counter of client Pod lookups for metadata.
+	metadataLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "kubepods",
+		Name:      "metadata_lookups_total",
+		Help:      "Counter of client Pod lookups for metadata, by result.",
+	}, []string{"result"})
+	// autopathLookups is the counter of client Pod lookups for autopath.
+	autopathLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: "kubepods",
+		Name:      "autopath_lookups_total",
+		Help:      "Counter of client Pod lookups for autopath, by result.",
+	}, []string{"result"})
+)
+
+// Answer paths of requests, used as the path label.
+const (
+	pathApex      = "apex"
+	pathName      = "name"
+	pathHostname  = "hostname"
+	pathNetwork   = "network"
+	pathOwner     = "owner"
+	pathLabel     = "label"
+	pathDashedIP  = "dashed_ip"
+	pathEcho      = "echo"
+	pathPTR       = "ptr"
+	pathSRV       = "srv"
+	pathTemplate  = "template"
+	pathNamespace = "namespace"
+	pathUnsynced  = "unsynced"
+	pathStale     = "stale"
+	pathOther     = "other"
+)
+
+// reportRequest updates the request metrics.
+func reportRequest(server string, qtype uint16, rcode int, path string, start time.Time) {
+	t, ok := dns.TypeToString[qtype]
+	if !ok {
+		t = "other"
+	}
+	rc, ok := dns.RcodeToString[rcode]
+	if !ok {
+		rc = strconv.Itoa(rcode)
+	}
+	requestCount.WithLabelValues(server, t, rc, path).Inc()
+	requestDuration.WithLabelValues(server).Observe(time.Since(start).Seconds())
+}
+
+// lookupResult returns the result label of a client Pod lookup.
+func lookupResult(found bool) string {
+	if found {
+		return "hit"
+	}
+	return "miss"
+}
+
+// countPods adds pods and ips to the number of cached Pods and addresses.
+func (k *KubePods) countPods(pods, ips int) {
+	atomic.AddInt64(&k.podCount, int64(pods))
+	atomic.AddInt64(&k.ipCount, int64(ips))
+	cachedPods.Add(float64(pods))
+	cachedIPs.Add(float64(ips))
+}
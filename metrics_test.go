@@ -0,0 +1,97 @@
+package kubepods
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/request"
+)
+
+func TestMetrics(t *testing.T) {
+	k := New([]string{"cluster.local.", "in-addr.arpa."})
+	k.mode = modeNameAndIP
+	k.client = fake.NewSimpleClientset()
+	ctx := context.Background()
+
+	pods, ips := testutil.ToFloat64(cachedPods), testutil.ToFloat64(cachedIPs)
+	adds := testutil.ToFloat64(podEvents.WithLabelValues("add"))
+	deletes := testutil.ToFloat64(podEvents.WithLabelValues("delete"))
+
+	addFixtures(ctx, k)
+	k.setWatch(ctx)
+	go k.controller.Run(k.stopCh)
+	for atomic.LoadInt32(&k.synced) == 0 {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	if c := testutil.ToFloat64(cachedPods); c != pods+3 {
+		t.Errorf("Expected %v cached Pods, got %v", pods+3, c)
+	}
+	if c := testutil.ToFloat64(cachedIPs); c != ips+7 {
+		t.Errorf("Expected %v cached IPs, got %v", ips+7, c)
+	}
+	if c := testutil.ToFloat64(podEvents.WithLabelValues("add")); c != adds+3 {
+		t.Errorf("Expected %v add events, got %v", adds+3, c)
+	}
+
+	k.client.CoreV1().Pods("namespace2").Delete(ctx, "pod2", meta.DeleteOptions{})
+	for testutil.ToFloat64(podEvents.WithLabelValues("delete")) == deletes {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if c := testutil.ToFloat64(cachedIPs); c != ips+5 {
+		t.Errorf("Expected %v cached IPs, got %v", ips+5, c)
+	}
+
+	tests := []struct {
+		qname string
+		qtype uint16
+		rcode string
+		path  string
+	}{
+		{"cluster.local.", dns.TypeSOA, "NOERROR", pathApex},
+		{"pod1.namespace1.cluster.local.", dns.TypeA, "NOERROR", pathName},
+		{"1-2-3-4.namespace1.cluster.local.", dns.TypeA, "NOERROR", pathDashedIP},
+		{"host3.sub3.namespace1.cluster.local.", dns.TypeA, "NOERROR", pathHostname},
+		{"_http._tcp.pod1.namespace1.cluster.local.", dns.TypeSRV, "NOERROR", pathSRV},
+		{"namespace1.cluster.local.", dns.TypeA, "NOERROR", pathNamespace},
+		{"4.3.2.1.in-addr.arpa.", dns.TypePTR, "NOERROR", pathPTR},
+		{"pod2.namespace2.cluster.local.", dns.TypeA, "NXDOMAIN", pathName},
+	}
+	for _, tc := range tests {
+		label := []string{"", dns.TypeToString[tc.qtype], tc.rcode, tc.path}
+		before := testutil.ToFloat64(requestCount.WithLabelValues(label...))
+		r := new(dns.Msg)
+		r.SetQuestion(tc.qname, tc.qtype)
+		k.ServeDNS(ctx, dnstest.NewRecorder(&test.ResponseWriter{}), r)
+		if c := testutil.ToFloat64(requestCount.WithLabelValues(label...)); c != before+1 {
+			t.Errorf("Expected request for %s to be counted with labels %v", tc.qname, label)
+		}
+	}
+
+	hits := testutil.ToFloat64(metadataLookups.WithLabelValues("hit"))
+	misses := testutil.ToFloat64(autopathLookups.WithLabelValues("miss"))
+	k.Metadata(ctx, request.Request{W: &test.ResponseWriter{RemoteIP: "1.2.3.4"}, Req: new(dns.Msg)})
+	r := new(dns.Msg)
+	r.SetQuestion("example.cluster.local.", dns.TypeA)
+	k.AutoPath(request.Request{W: &test.ResponseWriter{RemoteIP: "10.9.9.9"}, Req: r})
+	if c := testutil.ToFloat64(metadataLookups.WithLabelValues("hit")); c != hits+1 {
+		t.Errorf("Expected %v metadata hits, got %v", hits+1, c)
+	}
+	if c := testutil.ToFloat64(autopathLookups.WithLabelValues("miss")); c != misses+1 {
+		t.Errorf("Expected %v autopath misses, got %v", misses+1, c)
+	}
+
+	stopWatch(k)()
+	if c := testutil.ToFloat64(cachedPods); c != pods {
+		t.Errorf("Expected %v cached Pods after stop, got %v", pods, c)
+	}
+}
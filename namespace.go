@@ -0,0 +1,39 @@
+package kubepods
+
+import (
+	"sort"
+
+	"github.com/miekg/dns"
+
+	"github.com/coredns/coredns/request"
+)
+
+// defaultNamespaceRecords is the maximum number of records answered for a namespace if
+// namespace_records is given without one.
+const defaultNamespaceRecords = 256
+
+// serveNamespace answers queries for namespace names with the addresses of the Pods found in
+// items, which are the Pods of the namespace. At most k.namespaceRecords records are answered,
+// from the Pods in the order of their names.
+func (k *KubePods) serveNamespace(state request.Request, items []interface{}) (int, error) {
+	pods, err := k.servedPods(items)
+	if err != nil {
+		return dns.RcodeServerFailure, err
+	}
+	sort.Slice(pods, func(i, j int) bool { return pods[i].Name < pods[j].Name })
+
+	var records []dns.RR
+	for _, pod := range pods {
+		records = append(records, k.addressRecords(state.Name(), state.QType(), pod)...)
+		if len(records) >= k.namespaceRecords {
+			records = records[:k.namespaceRecords]
+			break
+		}
+	}
+	if len(records) == 0 {
+		return k.nodata(state)
+	}
+
+	k.writeResponse(state.W, state.Req, records, nil, nil, dns.RcodeSuccess)
+	return dns.RcodeSuccess, nil
+}
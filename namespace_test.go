@@ -0,0 +1,128 @@
+package kubepods
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+)
+
+func TestServeDNSNamespaceRecords(t *testing.T) {
+	k := New([]string{"cluster.local."})
+	k.mode = modeName
+	k.namespaceRecords = 2
+
+	k.client = fake.NewSimpleClientset()
+	ctx := context.Background()
+	addFixtures(ctx, k)
+
+	k.setWatch(ctx)
+	go k.controller.Run(k.stopCh)
+	defer close(k.stopCh)
+
+	// quick and dirty wait for sync
+	for !k.controller.HasSynced() {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	runTests(t, ctx, k, []test.Case{
+		{
+			// capped to the addresses of pod1, before pod3
+			Qname: "namespace1.cluster.local.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeSuccess,
+			Answer: []dns.RR{
+				test.A("namespace1.cluster.local.	5	IN	A	1.2.3.4"),
+				test.A("namespace1.cluster.local.	5	IN	A	5.6.7.8"),
+			},
+		},
+		{
+			Qname: "namespace1.cluster.local.", Qtype: dns.TypeAAAA,
+			Rcode: dns.RcodeSuccess,
+			Answer: []dns.RR{
+				test.AAAA("namespace1.cluster.local.	5	IN	AAAA	1:2:3::4"),
+				test.AAAA("namespace1.cluster.local.	5	IN	AAAA	5:6:7::8"),
+			},
+		},
+		{
+			Qname: "namespace2.cluster.local.", Qtype: dns.TypeAAAA,
+			Rcode: dns.RcodeSuccess,
+			Ns:    []dns.RR{k.soa("cluster.local.")},
+		},
+		{
+			Qname: "namespace2.cluster.local.", Qtype: dns.TypeTXT,
+			Rcode: dns.RcodeSuccess,
+			Ns:    []dns.RR{k.soa("cluster.local.")},
+		},
+		{
+			Qname: "namespace3.cluster.local.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeNameError,
+			Ns:    []dns.RR{k.soa("cluster.local.")},
+		},
+	})
+}
+
+func TestServeDNSNamespaceRecordsTruncated(t *testing.T) {
+	k := New([]string{"cluster.local."})
+	k.mode = modeName
+	k.namespaceRecords = defaultNamespaceRecords
+
+	k.client = fake.NewSimpleClientset()
+	ctx := context.Background()
+	const pods = 100
+	for i := 0; i < pods; i++ {
+		k.client.CoreV1().Pods("big").Create(ctx, &core.Pod{
+			ObjectMeta: meta.ObjectMeta{Name: fmt.Sprintf("pod%03d", i), Namespace: "big"},
+			Status:     core.PodStatus{PodIPs: []core.PodIP{{IP: fmt.Sprintf("10.1.0.%d", i)}}},
+		}, meta.CreateOptions{})
+	}
+
+	k.setWatch(ctx)
+	go k.controller.Run(k.stopCh)
+	defer close(k.stopCh)
+
+	// quick and dirty wait for sync
+	for !k.controller.HasSynced() {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	tests := []struct {
+		tcp       bool
+		bufsize   uint16
+		truncated bool
+	}{
+		{false, 0, true},
+		{false, 4096, false},
+		{true, 0, false},
+	}
+	for i, tc := range tests {
+		r := new(dns.Msg)
+		r.SetQuestion("big.cluster.local.", dns.TypeA)
+		if tc.bufsize > 0 {
+			r.SetEdns0(tc.bufsize, false)
+		}
+		w := dnstest.NewRecorder(&test.ResponseWriter{TCP: tc.tcp})
+		if _, err := k.ServeDNS(ctx, w, r); err != nil {
+			t.Fatalf("Test %d: unexpected error: %v", i, err)
+		}
+		if w.Msg.Truncated != tc.truncated {
+			t.Errorf("Test %d: expected truncated %v, got %v", i, tc.truncated, w.Msg.Truncated)
+		}
+		if tc.truncated {
+			if w.Msg.Len() > dns.MinMsgSize {
+				t.Errorf("Test %d: expected at most %d bytes, got %d", i, dns.MinMsgSize, w.Msg.Len())
+			}
+			continue
+		}
+		if len(w.Msg.Answer) != pods {
+			t.Errorf("Test %d: expected %d answers, got %d", i, pods, len(w.Msg.Answer))
+		}
+	}
+}
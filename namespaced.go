@@ -0,0 +1,102 @@
+package kubepods
+
+import (
+	"strings"
+	"sync"
+
+	"k8s.io/client-go/tools/cache"
+)
+
+// podIndexer is the part of cache.Indexer used to look up Pods.
+type podIndexer interface {
+	ByIndex(indexName, indexedValue string) ([]interface{}, error)
+	GetByKey(key string) (interface{}, bool, error)
+	List() []interface{}
+	Add(obj interface{}) error
+}
+
+// namespacedIndexer merges the indexers of per namespace informers.
+type namespacedIndexer map[string]cache.Indexer
+
+// ByIndex implements the podIndexer interface.
+func (n namespacedIndexer) ByIndex(indexName, indexedValue string) ([]interface{}, error) {
+	var items []interface{}
+	for _, indexer := range n {
+		i, err := indexer.ByIndex(indexName, indexedValue)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, i...)
+	}
+	return items, nil
+}
+
+// GetByKey implements the podIndexer interface.
+func (n namespacedIndexer) GetByKey(key string) (interface{}, bool, error) {
+	indexer, ok := n[keyNamespace(key)]
+	if !ok {
+		return nil, false, nil
+	}
+	return indexer.GetByKey(key)
+}
+
+// List implements the podIndexer interface.
+func (n namespacedIndexer) List() []interface{} {
+	var items []interface{}
+	for _, indexer := range n {
+		items = append(items, indexer.List()...)
+	}
+	return items
+}
+
+// Add implements the podIndexer interface. Objects in namespaces without an indexer are dropped.
+func (n namespacedIndexer) Add(obj interface{}) error {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		return err
+	}
+	indexer, ok := n[keyNamespace(key)]
+	if !ok {
+		return nil
+	}
+	return indexer.Add(obj)
+}
+
+// keyNamespace returns the namespace of a namespace/name key.
+func keyNamespace(key string) string {
+	if i := strings.Index(key, "/"); i >= 0 {
+		return key[:i]
+	}
+	return key
+}
+
+// namespacedController runs the controllers of per namespace informers.
+type namespacedController []cache.Controller
+
+// Run implements the cache.Controller interface.
+func (n namespacedController) Run(stopCh <-chan struct{}) {
+	var wg sync.WaitGroup
+	for _, c := range n {
+		wg.Add(1)
+		go func(c cache.Controller) {
+			defer wg.Done()
+			c.Run(stopCh)
+		}(c)
+	}
+	wg.Wait()
+}
+
+// HasSynced implements the cache.Controller interface. It returns true once all controllers
+// have synced.
+func (n namespacedController) HasSynced() bool {
+	for _, c := range n {
+		if !c.HasSynced() {
+			return false
+		}
+	}
+	return true
+}
+
+// LastSyncResourceVersion implements the cache.Controller interface. Resource versions of
+// different informers can't be compared, so this is always empty.
+func (n namespacedController) LastSyncResourceVersion() string { return "" }
@@ -0,0 +1,134 @@
+package kubepods
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/miekg/dns"
+	core "k8s.io/api/core/v1"
+
+	"github.com/coredns/coredns/request"
+)
+
+// networkStatusAnnotation is the annotation in which Multus lists the networks a Pod is attached to.
+const networkStatusAnnotation = "k8s.v1.cni.cncf.io/network-status"
+
+// networkStatus is an entry of the network status annotation.
+type networkStatus struct {
+	Name    string   `json:"name"` // namespace/name of the NetworkAttachmentDefinition
+	IPs     []string `json:"ips"`
+	Default bool     `json:"default"`
+}
+
+// podNetwork is a secondary network of a Pod, with the Pod's addresses on it.
+type podNetwork struct {
+	Name string // lowercase, without the namespace
+	IPs  []string
+}
+
+// podNetworks returns the secondary networks of pod from its network status annotation. The
+// default network is left out, its addresses are the Pod's IPs. Networks whose name is not a
+// valid DNS label are ignored.
+func podNetworks(pod *core.Pod) (networks []podNetwork) {
+	annotation, ok := pod.Annotations[networkStatusAnnotation]
+	if !ok {
+		return nil
+	}
+	var status []networkStatus
+	if err := json.Unmarshal([]byte(annotation), &status); err != nil {
+		log.Debugf("Invalid network status of Pod %s/%s: %s", pod.Namespace, pod.Name, err)
+		return nil
+	}
+
+	for _, s := range status {
+		if s.Default || len(s.IPs) == 0 {
+			continue
+		}
+		name := strings.ToLower(s.Name[strings.LastIndex(s.Name, "/")+1:])
+		if _, ok := dns.IsDomainName(name); !ok || dns.CountLabel(name) != 1 {
+			log.Debugf("Network %q of Pod %s/%s is not a valid DNS label", s.Name, pod.Namespace, pod.Name)
+			continue
+		}
+		// a Pod can have several interfaces on a network
+		found := false
+		for i := range networks {
+			if networks[i].Name == name {
+				networks[i].IPs = append(networks[i].IPs, s.IPs...)
+				found = true
+				break
+			}
+		}
+		if !found {
+			networks = append(networks, podNetwork{Name: name, IPs: append([]string(nil), s.IPs...)})
+		}
+	}
+	return networks
+}
+
+// allIPs returns the addresses of the Pod, including those on secondary networks.
+func (p *podRecord) allIPs() []string {
+	if len(p.Networks) == 0 {
+		return p.IPs
+	}
+	ips := append([]string(nil), p.IPs...)
+	for _, n := range p.Networks {
+		ips = append(ips, n.IPs...)
+	}
+	return ips
+}
+
+// network returns the name of the secondary network the Pod has the address ip on, or an
+// empty string if ip is not an address on a secondary network.
+func (p *podRecord) network(ip string) string {
+	for _, podIP := range p.IPs {
+		if podIP == ip {
+			return ""
+		}
+	}
+	for _, n := range p.Networks {
+		for _, networkIP := range n.IPs {
+			if networkIP == ip {
+				return n.Name
+			}
+		}
+	}
+	return ""
+}
+
+// networkIPs returns the addresses of the Pod on the secondary network name.
+func (p *podRecord) networkIPs(name string) []string {
+	for _, n := range p.Networks {
+		if n.Name == name {
+			return n.IPs
+		}
+	}
+	return nil
+}
+
+// serveNetwork answers queries for pod.network.namespace names with the addresses of the Pod on
+// the secondary network. It returns false if there is no such Pod on the network.
+func (k *KubePods) serveNetwork(state request.Request, name, network, namespace string) (int, bool, error) {
+	items, err := k.indexer.ByIndex("network", strings.Join([]string{namespace, network, name}, "/"))
+	if err != nil {
+		return dns.RcodeServerFailure, true, err
+	}
+	pods, err := k.servedPods(items)
+	if err != nil {
+		return dns.RcodeServerFailure, true, err
+	}
+	if len(pods) == 0 {
+		return 0, false, nil
+	}
+
+	var records []dns.RR
+	for _, pod := range pods {
+		records = append(records, k.ipRecords(state.Name(), state.QType(), pod.networkIPs(network))...)
+	}
+	if len(records) == 0 {
+		rcode, err := k.nodata(state)
+		return rcode, true, err
+	}
+
+	k.writeResponse(state.W, state.Req, records, nil, nil, dns.RcodeSuccess)
+	return dns.RcodeSuccess, true, nil
+}
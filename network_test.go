@@ -0,0 +1,131 @@
+package kubepods
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/coredns/coredns/plugin/test"
+)
+
+const networkStatusJSON = `[
+  {"name": "cbr0", "interface": "eth0", "ips": ["10.0.0.20"], "default": true},
+  {"name": "namespace1/MacVlan", "interface": "net1", "ips": ["192.168.1.20", "fd10::20"]},
+  {"name": "namespace1/macvlan", "interface": "net2", "ips": ["192.168.1.21"]},
+  {"name": "sriov", "interface": "net3", "ips": ["192.168.2.20"]},
+  {"name": "not_a.label", "interface": "net4", "ips": ["192.168.3.20"]}
+]`
+
+func TestPodNetworks(t *testing.T) {
+	pod := &core.Pod{ObjectMeta: meta.ObjectMeta{
+		Name:        "cnf1",
+		Namespace:   "namespace1",
+		Annotations: map[string]string{networkStatusAnnotation: networkStatusJSON},
+	}}
+	expect := []podNetwork{
+		{Name: "macvlan", IPs: []string{"192.168.1.20", "fd10::20", "192.168.1.21"}},
+		{Name: "sriov", IPs: []string{"192.168.2.20"}},
+	}
+	if networks := podNetworks(pod); !reflect.DeepEqual(networks, expect) {
+		t.Errorf("Expected %+v, got %+v", expect, networks)
+	}
+
+	pod.Annotations[networkStatusAnnotation] = "not json"
+	if networks := podNetworks(pod); networks != nil {
+		t.Errorf("Expected no networks for invalid annotation, got %+v", networks)
+	}
+}
+
+func TestServeDNSNetworks(t *testing.T) {
+	k := New([]string{"cluster.local.", "in-addr.arpa.", "ip6.arpa."})
+	k.mode = modeName
+
+	k.client = fake.NewSimpleClientset()
+	ctx := context.Background()
+	addFixtures(ctx, k)
+	k.client.CoreV1().Pods("namespace1").Create(ctx, &core.Pod{
+		ObjectMeta: meta.ObjectMeta{
+			Name:        "cnf1",
+			Namespace:   "namespace1",
+			Annotations: map[string]string{networkStatusAnnotation: networkStatusJSON},
+		},
+		Status: core.PodStatus{PodIPs: []core.PodIP{{IP: "10.0.0.20"}}},
+	}, meta.CreateOptions{})
+
+	k.setWatch(ctx)
+	go k.controller.Run(k.stopCh)
+	defer close(k.stopCh)
+
+	// quick and dirty wait for sync
+	for !k.controller.HasSynced() {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	runTests(t, ctx, k, []test.Case{
+		{
+			Qname: "cnf1.namespace1.cluster.local.", Qtype: dns.TypeA,
+			Rcode:  dns.RcodeSuccess,
+			Answer: []dns.RR{test.A("cnf1.namespace1.cluster.local.	5	IN	A	10.0.0.20")},
+		},
+		{
+			Qname: "cnf1.macvlan.namespace1.cluster.local.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeSuccess,
+			Answer: []dns.RR{
+				test.A("cnf1.macvlan.namespace1.cluster.local.	5	IN	A	192.168.1.20"),
+				test.A("cnf1.macvlan.namespace1.cluster.local.	5	IN	A	192.168.1.21"),
+			},
+		},
+		{
+			Qname: "cnf1.macvlan.namespace1.cluster.local.", Qtype: dns.TypeAAAA,
+			Rcode:  dns.RcodeSuccess,
+			Answer: []dns.RR{test.AAAA("cnf1.macvlan.namespace1.cluster.local.	5	IN	AAAA	fd10::20")},
+		},
+		{
+			Qname: "cnf1.sriov.namespace1.cluster.local.", Qtype: dns.TypeAAAA,
+			Rcode: dns.RcodeSuccess,
+			Ns:    []dns.RR{k.soa("cluster.local.")},
+		},
+		{
+			Qname: "cnf1.cbr0.namespace1.cluster.local.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeNameError,
+			Ns:    []dns.RR{k.soa("cluster.local.")},
+		},
+		{
+			Qname: "pod1.macvlan.namespace1.cluster.local.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeNameError,
+			Ns:    []dns.RR{k.soa("cluster.local.")},
+		},
+		{
+			// empty non-terminal
+			Qname: "macvlan.namespace1.cluster.local.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeSuccess,
+			Ns:    []dns.RR{k.soa("cluster.local.")},
+		},
+		{
+			Qname: "20.1.168.192.in-addr.arpa.", Qtype: dns.TypePTR,
+			Rcode:  dns.RcodeSuccess,
+			Answer: []dns.RR{test.PTR("20.1.168.192.in-addr.arpa.	5	IN	PTR	cnf1.macvlan.namespace1.cluster.local.")},
+		},
+		{
+			Qname: "20.0.0.10.in-addr.arpa.", Qtype: dns.TypePTR,
+			Rcode:  dns.RcodeSuccess,
+			Answer: []dns.RR{test.PTR("20.0.0.10.in-addr.arpa.	5	IN	PTR	cnf1.namespace1.cluster.local.")},
+		},
+	})
+
+	if pod, _ := k.podByIP("192.168.2.20"); pod == nil || pod.Name != "cnf1" {
+		t.Errorf("Expected cnf1 for address on secondary network, got %v", pod)
+	}
+
+	axfr := transferRecords(t, k, "cluster.local.", 0)
+	checkTransfer(t, axfr, []string{
+		"cnf1.macvlan.namespace1.cluster.local.	5	IN	A	192.168.1.20",
+		"cnf1.sriov.namespace1.cluster.local.	5	IN	A	192.168.2.20",
+	})
+}
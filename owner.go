@@ -0,0 +1,106 @@
+package kubepods
+
+import (
+	"strings"
+
+	"github.com/miekg/dns"
+	apps "k8s.io/api/apps/v1"
+	core "k8s.io/api/core/v1"
+
+	"github.com/coredns/coredns/request"
+)
+
+// podOwner is the controller of a Pod.
+type podOwner struct {
+	Kind string // lowercase, e.g. deployment
+	Name string
+}
+
+// controllerOwner returns the controller of pod, with ReplicaSets created by a Deployment
+// resolved to the Deployment. It returns nil if pod has no controller.
+func controllerOwner(pod *core.Pod) *podOwner {
+	for _, ref := range pod.OwnerReferences {
+		if ref.Controller == nil || !*ref.Controller {
+			continue
+		}
+		owner := &podOwner{Kind: strings.ToLower(ref.Kind), Name: strings.ToLower(ref.Name)}
+		// a Deployment names its ReplicaSets after itself and the Pod template hash
+		if hash := pod.Labels[apps.DefaultDeploymentUniqueLabelKey]; owner.Kind == "replicaset" && hash != "" && strings.HasSuffix(owner.Name, "-"+hash) {
+			owner.Kind, owner.Name = "deployment", strings.TrimSuffix(owner.Name, "-"+hash)
+		}
+		return owner
+	}
+	return nil
+}
+
+// ownerServed returns true if owner records are served for pod, which excludes terminated Pods.
+func (k *KubePods) ownerServed(pod *podRecord) bool {
+	return k.ownerRecords && pod.Owner != nil && k.serves(pod) && !terminated(pod)
+}
+
+// serveOwner answers queries for owner.kind.namespace names with the addresses of the live Pods
+// of the controller. It returns false if the controller has no such Pods.
+func (k *KubePods) serveOwner(state request.Request, podDomain string) (int, bool, error) {
+	segments := dns.SplitDomainName(podDomain)
+	n := len(segments)
+	if n < 3 {
+		return 0, false, nil
+	}
+	// the owner's name can have dots
+	key := strings.Join([]string{segments[n-1], segments[n-2], strings.Join(segments[:n-2], ".")}, "/")
+	return k.serveGroup(state, "owner", key)
+}
+
+// groupENT returns true if podDomain is an empty non-terminal above the names of groups of Pods,
+// such as kind.namespace above the names of the Pods of controllers, or key.label.namespace above
+// the names of the Pods with a label.
+func (k *KubePods) groupENT(podDomain string) (bool, error) {
+	segments := dns.SplitDomainName(podDomain)
+	n := len(segments)
+	if n < 2 {
+		return false, nil
+	}
+	key := strings.Join([]string{segments[n-1], strings.Join(segments[:n-1], ".")}, "/")
+	var indexes []string
+	if k.ownerRecords {
+		indexes = append(indexes, "ownerent")
+	}
+	if len(k.labelKeys) > 0 {
+		indexes = append(indexes, "labelent")
+	}
+	for _, index := range indexes {
+		items, err := k.indexer.ByIndex(index, key)
+		if err != nil || len(items) > 0 {
+			return len(items) > 0, err
+		}
+	}
+	return false, nil
+}
+
+// serveGroup answers a query with the addresses of all Pods found in index under key. It returns
+// false if there are no such Pods.
+func (k *KubePods) serveGroup(state request.Request, index, key string) (int, bool, error) {
+	items, err := k.indexer.ByIndex(index, key)
+	if err != nil {
+		return dns.RcodeServerFailure, true, err
+	}
+	pods, err := k.servedPods(items)
+	if err != nil {
+		return dns.RcodeServerFailure, true, err
+	}
+	if len(pods) == 0 {
+		return 0, false, nil
+	}
+
+	var records []dns.RR
+	for _, pod := range pods {
+		records = append(records, k.addressRecords(state.Name(), state.QType(), pod)...)
+	}
+	if len(records) == 0 {
+		rcode, err := k.nodata(state)
+		return rcode, true, err
+	}
+
+	k.writeResponse(state.W, state.Req, records, nil, nil, dns.RcodeSuccess)
+	return dns.RcodeSuccess, true, nil
+}
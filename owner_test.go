@@ -0,0 +1,147 @@
+package kubepods
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/coredns/coredns/plugin/test"
+)
+
+// ownedPod returns a Pod controlled by the kind and name, with the labels and phase.
+func ownedPod(name, ip, kind, owner string, labels map[string]string, phase core.PodPhase) *core.Pod {
+	controller := true
+	return &core.Pod{
+		ObjectMeta: meta.ObjectMeta{
+			Name:            name,
+			Namespace:       "namespace1",
+			Labels:          labels,
+			OwnerReferences: []meta.OwnerReference{{Kind: kind, Name: owner, Controller: &controller}},
+		},
+		Status: core.PodStatus{Phase: phase, PodIPs: []core.PodIP{{IP: ip}}},
+	}
+}
+
+func TestControllerOwner(t *testing.T) {
+	hash := map[string]string{"pod-template-hash": "5d4f8"}
+	tests := []struct {
+		pod    *core.Pod
+		expect *podOwner
+	}{
+		{ownedPod("web-5d4f8-x", "", "ReplicaSet", "web-5d4f8", hash, ""), &podOwner{Kind: "deployment", Name: "web"}},
+		{ownedPod("rs-x", "", "ReplicaSet", "rs", nil, ""), &podOwner{Kind: "replicaset", Name: "rs"}},
+		{ownedPod("rs-x", "", "ReplicaSet", "rs", hash, ""), &podOwner{Kind: "replicaset", Name: "rs"}},
+		{ownedPod("db-0", "", "StatefulSet", "db", nil, ""), &podOwner{Kind: "statefulset", Name: "db"}},
+		{&core.Pod{ObjectMeta: meta.ObjectMeta{
+			OwnerReferences: []meta.OwnerReference{{Kind: "Job", Name: "batch"}},
+		}}, nil},
+	}
+	for i, tc := range tests {
+		if owner := controllerOwner(tc.pod); !reflect.DeepEqual(owner, tc.expect) {
+			t.Errorf("Test %d: expected %+v, got %+v", i, tc.expect, owner)
+		}
+	}
+}
+
+func TestServeDNSOwners(t *testing.T) {
+	k := New([]string{"cluster.local.", "ip.local.", "in-addr.arpa."})
+	k.mode = modeName
+	k.zoneModes["ip.local."] = modeIP
+	k.ownerRecords = true
+
+	k.client = fake.NewSimpleClientset()
+	ctx := context.Background()
+	addFixtures(ctx, k)
+	hash := map[string]string{"pod-template-hash": "5d4f8"}
+	for _, pod := range []*core.Pod{
+		ownedPod("web-5d4f8-a", "10.0.2.1", "ReplicaSet", "web-5d4f8", hash, core.PodRunning),
+		ownedPod("web-5d4f8-b", "10.0.2.2", "ReplicaSet", "web-5d4f8", hash, core.PodRunning),
+		ownedPod("web-5d4f8-c", "10.0.2.3", "ReplicaSet", "web-5d4f8", hash, core.PodFailed),
+		ownedPod("batch-x", "10.0.2.4", "Job", "batch", nil, core.PodRunning),
+		ownedPod("batch-y", "10.0.2.5", "Job", "batch", nil, core.PodSucceeded),
+	} {
+		k.client.CoreV1().Pods(pod.Namespace).Create(ctx, pod, meta.CreateOptions{})
+	}
+
+	k.setWatch(ctx)
+	go k.controller.Run(k.stopCh)
+	defer close(k.stopCh)
+
+	// quick and dirty wait for sync
+	for !k.controller.HasSynced() {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	runTests(t, ctx, k, []test.Case{
+		{
+			Qname: "web.deployment.namespace1.cluster.local.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeSuccess,
+			Answer: []dns.RR{
+				test.A("web.deployment.namespace1.cluster.local.	5	IN	A	10.0.2.1"),
+				test.A("web.deployment.namespace1.cluster.local.	5	IN	A	10.0.2.2"),
+			},
+		},
+		{
+			Qname: "batch.job.namespace1.cluster.local.", Qtype: dns.TypeA,
+			Rcode:  dns.RcodeSuccess,
+			Answer: []dns.RR{test.A("batch.job.namespace1.cluster.local.	5	IN	A	10.0.2.4")},
+		},
+		{
+			Qname: "batch.job.namespace1.cluster.local.", Qtype: dns.TypeAAAA,
+			Rcode: dns.RcodeSuccess,
+			Ns:    []dns.RR{k.soa("cluster.local.")},
+		},
+		{
+			Qname: "web-5d4f8.replicaset.namespace1.cluster.local.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeNameError,
+			Ns:    []dns.RR{k.soa("cluster.local.")},
+		},
+		{
+			Qname: "web.deployment.namespace2.cluster.local.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeNameError,
+			Ns:    []dns.RR{k.soa("cluster.local.")},
+		},
+		{
+			// empty non-terminal
+			Qname: "deployment.namespace1.cluster.local.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeSuccess,
+			Ns:    []dns.RR{k.soa("cluster.local.")},
+		},
+		{
+			Qname: "web.deployment.namespace1.ip.local.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeSuccess,
+			Answer: []dns.RR{
+				test.A("web.deployment.namespace1.ip.local.	5	IN	A	10.0.2.1"),
+				test.A("web.deployment.namespace1.ip.local.	5	IN	A	10.0.2.2"),
+			},
+		},
+		{
+			// empty non-terminal without Pod names
+			Qname: "deployment.namespace1.ip.local.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeSuccess,
+			Ns:    []dns.RR{k.soa("ip.local.")},
+		},
+		{
+			Qname: "statefulset.namespace1.ip.local.", Qtype: dns.TypeA,
+			Rcode: dns.RcodeNameError,
+			Ns:    []dns.RR{k.soa("ip.local.")},
+		},
+		{
+			Qname: "host3.sub3.namespace1.cluster.local.", Qtype: dns.TypeA,
+			Rcode:  dns.RcodeSuccess,
+			Answer: []dns.RR{test.A("host3.sub3.namespace1.cluster.local.	5	IN	A	10.0.0.3")},
+		},
+	})
+
+	axfr := transferRecords(t, k, "cluster.local.", 0)
+	checkTransfer(t, axfr, []string{
+		"web.deployment.namespace1.cluster.local.	5	IN	A	10.0.2.1",
+		"web.deployment.namespace1.cluster.local.	5	IN	A	10.0.2.2",
+	})
+}
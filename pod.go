@@ -0,0 +1,139 @@
+package kubepods
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/coredns/coredns/plugin/kubernetes/object"
+
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// podRecord is a stripped down core.Pod with only the items needed to create records, metadata
+// and autopath. It is what the Pod cache stores.
+type podRecord struct {
+	Version     string
+	Name        string
+	Namespace   string
+	Annotations map[string]string
+	Created     meta.Time
+	IPs         []string
+	Hostname    string
+	Subdomain   string
+	HostNetwork bool
+	Networks    []podNetwork      // secondary networks from the network status annotation
+	Owner       *podOwner         // controller, nil if there is none
+	Labels      map[string]string // values of the labels in labelKeys, by the name of their key
+	Ports       []podPort         // named container ports only
+	Names       []templateName    // names built from the name template
+	Phase       core.PodPhase
+	Ready       bool
+
+	*object.Empty
+}
+
+// podPort is a named container port.
+type podPort struct {
+	Name     string
+	Protocol string // lowercase
+	Port     int32
+}
+
+// toPodRecord converts a *core.Pod to a *podRecord.
+func (k *KubePods) toPodRecord(obj meta.Object) (meta.Object, error) {
+	pod, ok := obj.(*core.Pod)
+	if !ok {
+		return nil, fmt.Errorf("unexpected object %v", obj)
+	}
+	ips := k.addresses.Addresses(pod)
+	p := &podRecord{
+		Version:     pod.GetResourceVersion(),
+		Name:        pod.GetName(),
+		Namespace:   pod.GetNamespace(),
+		Annotations: pod.GetAnnotations(),
+		Created:     pod.GetCreationTimestamp(),
+		Hostname:    pod.Spec.Hostname,
+		Subdomain:   pod.Spec.Subdomain,
+		HostNetwork: pod.Spec.HostNetwork,
+		Networks:    podNetworks(pod),
+		Owner:       controllerOwner(pod),
+		Labels:      k.queriedLabels(pod),
+		IPs:         ips,
+		Names:       k.templateNames(pod, ips),
+		Phase:       pod.Status.Phase,
+	}
+	for _, c := range pod.Spec.Containers {
+		for _, port := range c.Ports {
+			if port.Name == "" {
+				continue
+			}
+			protocol := port.Protocol
+			if protocol == "" {
+				protocol = core.ProtocolTCP
+			}
+			p.Ports = append(p.Ports, podPort{Name: strings.ToLower(port.Name), Protocol: strings.ToLower(string(protocol)), Port: port.ContainerPort})
+		}
+	}
+	for _, c := range pod.Status.Conditions {
+		if c.Type == core.PodReady {
+			p.Ready = c.Status == core.ConditionTrue
+			break
+		}
+	}
+	return p, nil
+}
+
+var _ runtime.Object = &podRecord{}
+
+// DeepCopyObject implements the runtime.Object interface.
+func (p *podRecord) DeepCopyObject() runtime.Object {
+	p1 := *p
+	p1.Annotations = make(map[string]string, len(p.Annotations))
+	for k, v := range p.Annotations {
+		p1.Annotations[k] = v
+	}
+	p1.IPs = append([]string(nil), p.IPs...)
+	p1.Networks = nil
+	for _, n := range p.Networks {
+		p1.Networks = append(p1.Networks, podNetwork{Name: n.Name, IPs: append([]string(nil), n.IPs...)})
+	}
+	if p.Labels != nil {
+		p1.Labels = make(map[string]string, len(p.Labels))
+		for k, v := range p.Labels {
+			p1.Labels[k] = v
+		}
+	}
+	if p.Owner != nil {
+		owner := *p.Owner
+		p1.Owner = &owner
+	}
+	p1.Ports = append([]podPort(nil), p.Ports...)
+	p1.Names = append([]templateName(nil), p.Names...)
+	return &p1
+}
+
+// GetNamespace implements the metav1.Object interface.
+func (p *podRecord) GetNamespace() string { return p.Namespace }
+
+// SetNamespace implements the metav1.Object interface.
+func (p *podRecord) SetNamespace(namespace string) {}
+
+// GetName implements the metav1.Object interface.
+func (p *podRecord) GetName() string { return p.Name }
+
+// SetName implements the metav1.Object interface.
+func (p *podRecord) SetName(name string) {}
+
+// GetResourceVersion implements the metav1.Object interface.
+func (p *podRecord) GetResourceVersion() string { return p.Version }
+
+// SetResourceVersion implements the metav1.Object interface.
+func (p *podRecord) SetResourceVersion(version string) {}
+
+// GetAnnotations implements the metav1.Object interface.
+func (p *podRecord) GetAnnotations() map[string]string { return p.Annotations }
+
+// GetCreationTimestamp implements the metav1.Object interface.
+func (p *podRecord) GetCreationTimestamp() meta.Time { return p.Created }
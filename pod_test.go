@@ -0,0 +1,182 @@
+package kubepods
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestToPodRecord(t *testing.T) {
+	k := New([]string{"cluster.local."})
+	k.template, _ = parseTemplate("{{.Name}}.{{.Namespace}}")
+
+	created := meta.NewTime(time.Unix(1000, 0))
+	pod := &core.Pod{
+		ObjectMeta: meta.ObjectMeta{
+			Name:              "pod1",
+			Namespace:         "namespace1",
+			ResourceVersion:   "42",
+			CreationTimestamp: created,
+			Annotations:       map[string]string{"a": "b"},
+		},
+		Spec: core.PodSpec{
+			Hostname:    "host1",
+			Subdomain:   "sub1",
+			HostNetwork: true,
+			Containers: []core.Container{
+				{Ports: []core.ContainerPort{{Name: "HTTP", ContainerPort: 80}, {ContainerPort: 8080}}},
+				{Ports: []core.ContainerPort{{Name: "dns", ContainerPort: 53, Protocol: core.ProtocolUDP}}},
+			},
+		},
+		Status: core.PodStatus{
+			Phase:      core.PodRunning,
+			Conditions: []core.PodCondition{{Type: core.PodReady, Status: core.ConditionTrue}},
+			PodIPs:     []core.PodIP{{IP: "10.0.0.1"}, {IP: "fd00::1"}},
+		},
+	}
+
+	obj, err := k.toPodRecord(pod)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expect := &podRecord{
+		Version:     "42",
+		Name:        "pod1",
+		Namespace:   "namespace1",
+		Annotations: map[string]string{"a": "b"},
+		Created:     created,
+		IPs:         []string{"10.0.0.1", "fd00::1"},
+		Hostname:    "host1",
+		Subdomain:   "sub1",
+		HostNetwork: true,
+		Ports:       []podPort{{Name: "http", Protocol: "tcp", Port: 80}, {Name: "dns", Protocol: "udp", Port: 53}},
+		Names:       []templateName{{Name: "pod1.namespace1", IP: "10.0.0.1"}, {Name: "pod1.namespace1", IP: "fd00::1"}},
+		Phase:       core.PodRunning,
+		Ready:       true,
+	}
+	if !reflect.DeepEqual(obj, expect) {
+		t.Errorf("Expected %+v, got %+v", expect, obj)
+	}
+
+	if c := obj.(*podRecord).DeepCopyObject(); !reflect.DeepEqual(c, expect) {
+		t.Errorf("Expected copy %+v, got %+v", expect, c)
+	}
+
+	if _, err := k.toPodRecord(&core.Service{}); err == nil {
+		t.Error("Expected error for a Service")
+	}
+}
+
+// benchPods is the number of Pods stored in the cache benchmarks.
+const benchPods = 100000
+
+// benchPod returns a Pod similar to what the API returns for a Pod of a Deployment.
+func benchPod(i int) *core.Pod {
+	controller := true
+	return &core.Pod{
+		ObjectMeta: meta.ObjectMeta{
+			Name:              fmt.Sprintf("app-%d-5d4f8b7c9-x%05d", i/100, i),
+			Namespace:         fmt.Sprintf("namespace-%d", i%50),
+			UID:               "0b4d6c1e-5a3f-4f64-9a8e-0c7d3b5e2f1a",
+			ResourceVersion:   fmt.Sprint(1000000 + i),
+			CreationTimestamp: meta.Now(),
+			Labels:            map[string]string{"app": fmt.Sprintf("app-%d", i/100), "pod-template-hash": "5d4f8b7c9"},
+			Annotations:       map[string]string{"kubectl.kubernetes.io/restartedAt": "2022-02-01T10:00:00Z"},
+			OwnerReferences: []meta.OwnerReference{{
+				APIVersion: "apps/v1", Kind: "ReplicaSet", Name: fmt.Sprintf("app-%d-5d4f8b7c9", i/100),
+				UID: "7c9e2b1a-3d4f-4e5a-8b6c-1f2e3d4c5b6a", Controller: &controller,
+			}},
+			ManagedFields: []meta.ManagedFieldsEntry{
+				{Manager: "kube-controller-manager", Operation: meta.ManagedFieldsOperationUpdate, APIVersion: "v1", FieldsType: "FieldsV1",
+					FieldsV1: &meta.FieldsV1{Raw: make([]byte, 2048)}},
+				{Manager: "kubelet", Operation: meta.ManagedFieldsOperationUpdate, APIVersion: "v1", FieldsType: "FieldsV1", Subresource: "status",
+					FieldsV1: &meta.FieldsV1{Raw: make([]byte, 1024)}},
+			},
+		},
+		Spec: core.PodSpec{
+			NodeName: fmt.Sprintf("node-%d", i%1000),
+			Containers: []core.Container{{
+				Name:         "app",
+				Image:        "registry.example.org/app:1.2.3",
+				Args:         []string{"--port=8080", "--metrics-port=9090"},
+				Ports:        []core.ContainerPort{{Name: "http", ContainerPort: 8080, Protocol: core.ProtocolTCP}, {Name: "metrics", ContainerPort: 9090, Protocol: core.ProtocolTCP}},
+				Env:          []core.EnvVar{{Name: "LOG_LEVEL", Value: "info"}, {Name: "REGION", Value: "eu-west-1"}},
+				VolumeMounts: []core.VolumeMount{{Name: "kube-api-access", MountPath: "/var/run/secrets/kubernetes.io/serviceaccount", ReadOnly: true}},
+			}},
+			Volumes: []core.Volume{{Name: "kube-api-access"}},
+		},
+		Status: core.PodStatus{
+			Phase: core.PodRunning,
+			Conditions: []core.PodCondition{
+				{Type: core.PodInitialized, Status: core.ConditionTrue},
+				{Type: core.PodReady, Status: core.ConditionTrue},
+				{Type: core.ContainersReady, Status: core.ConditionTrue},
+				{Type: core.PodScheduled, Status: core.ConditionTrue},
+			},
+			HostIP: "192.168.0.1",
+			PodIP:  fmt.Sprintf("10.%d.%d.%d", i>>16&255, i>>8&255, i&255),
+			PodIPs: []core.PodIP{{IP: fmt.Sprintf("10.%d.%d.%d", i>>16&255, i>>8&255, i&255)}},
+			ContainerStatuses: []core.ContainerStatus{{
+				Name:        "app",
+				Ready:       true,
+				Image:       "registry.example.org/app:1.2.3",
+				ImageID:     "registry.example.org/app@sha256:4c2b7e9f0a1d3c5e7f9b2d4f6a8c0e2b4d6f8a0c2e4b6d8f0a2c4e6b8d0f2a4c",
+				ContainerID: "containerd://9f8e7d6c5b4a39281706f5e4d3c2b1a09f8e7d6c5b4a39281706f5e4d3c2b1a0",
+			}},
+		},
+	}
+}
+
+// benchmarkCache stores benchPods Pods in an indexer with indexers, after converting them with
+// convert, and reports the heap in use by the cache.
+func benchmarkCache(b *testing.B, indexers cache.Indexers, convert func(*core.Pod) interface{}) {
+	var before, after runtime.MemStats
+	for n := 0; n < b.N; n++ {
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+
+		indexer := cache.NewIndexer(cache.DeletionHandlingMetaNamespaceKeyFunc, indexers)
+		for i := 0; i < benchPods; i++ {
+			if err := indexer.Add(convert(benchPod(i))); err != nil {
+				b.Fatal(err)
+			}
+		}
+
+		runtime.GC()
+		runtime.ReadMemStats(&after)
+		b.ReportMetric(float64(after.HeapAlloc-before.HeapAlloc)/(1<<20), "MiB")
+		runtime.KeepAlive(indexer)
+	}
+}
+
+// BenchmarkCachePods shows the memory used when Pods are cached as they are received. Only the
+// reverse and namespace indexes are kept, so it underestimates the difference.
+func BenchmarkCachePods(b *testing.B) {
+	indexers := cache.Indexers{
+		"reverse": func(obj interface{}) ([]string, error) {
+			var idx []string
+			for _, ip := range obj.(*core.Pod).Status.PodIPs {
+				idx = append(idx, ip.IP)
+			}
+			return idx, nil
+		},
+		"namespace": cache.MetaNamespaceIndexFunc,
+	}
+	benchmarkCache(b, indexers, func(pod *core.Pod) interface{} { return pod })
+}
+
+// BenchmarkCacheRecords shows the memory used when Pods are cached as podRecords.
+func BenchmarkCacheRecords(b *testing.B) {
+	k := New([]string{"cluster.local."})
+	k.mode = modeNameAndIP
+	benchmarkCache(b, k.indexers(), func(pod *core.Pod) interface{} {
+		record, _ := k.toPodRecord(pod)
+		return record
+	})
+}
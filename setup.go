@@ -4,12 +4,17 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"os"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/miekg/dns"
 	core "k8s.io/api/core/v1"
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/tools/cache"
@@ -17,7 +22,9 @@ import (
 	"github.com/coredns/caddy"
 	"github.com/coredns/coredns/core/dnsserver"
 	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/kubernetes/object"
 	clog "github.com/coredns/coredns/plugin/pkg/log"
+	"github.com/coredns/coredns/plugin/transfer"
 	"github.com/coredns/kubeapi"
 )
 
@@ -33,14 +40,25 @@ func setup(c *caddy.Controller) error {
 		return plugin.Error(pluginName, err)
 	}
 
-	if k.mode != modeEchoIP {
+	if !k.echoOnly() {
 		k.setWatch(context.Background())
+		for _, s := range k.sources() {
+			if s.snapshotFile == "" {
+				continue
+			}
+			if err := s.loadSnapshot(); err != nil {
+				log.Warningf("Failed to load snapshot %q: %s", s.snapshotFile, err)
+			}
+		}
 		c.OnStartup(startWatch(k, dnsserver.GetConfig(c)))
 		c.OnShutdown(stopWatch(k))
 	}
 
 	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
 		k.Next = next
+		for _, c := range k.clusters {
+			c.Next = next
+		}
 		return k
 	})
 
@@ -72,6 +90,8 @@ func parse(c *caddy.Controller) (*KubePods, error) {
 func parseStanza(c *caddy.Controller) (*KubePods, error) {
 	kps := New(plugin.OriginsFromArgsOrServerBlock(c.RemainingArgs(), c.ServerBlockKeys))
 	kps.mode = modeName
+	names, tmpl := false, false
+	var clusters [][]string // name, kubeconfig and context of each cluster
 	for c.NextBlock() {
 		switch c.Val() {
 		// TODO: operation modes
@@ -79,19 +99,287 @@ func parseStanza(c *caddy.Controller) (*KubePods, error) {
 			kps.Fall.SetZonesFromArgs(c.RemainingArgs())
 		case "names":
 			args := c.RemainingArgs()
-			if len(args) != 1 {
+			if len(args) == 0 {
 				return nil, c.ArgErr()
 			}
+			var mode int
 			switch args[0] {
 			case "echo-ip":
-				kps.mode = modeEchoIP
+				mode = modeEchoIP
 			case "ip":
-				kps.mode = modeIP
+				mode = modeIP
 			case "name":
-				kps.mode = modeName
+				mode = modeName
 			case "name-and-ip":
-				kps.mode = modeNameAndIP
+				mode = modeNameAndIP
+			default:
+				return nil, c.Errf("unknown names mode '%s'", args[0])
+			}
+			if len(args) > 1 {
+				// the mode of the listed zones only
+				for _, z := range plugin.Host(strings.Join(args[1:], " ")).NormalizeExact() {
+					if plugin.Zones(kps.Zones).Matches(z) != z {
+						return nil, c.Errf("names zone '%s' is not a zone of the plugin", z)
+					}
+					if isReverseZone(z) {
+						return nil, c.Errf("names zone '%s' is a reverse zone", z)
+					}
+					kps.zoneModes[z] = mode
+				}
+				continue
+			}
+			if tmpl {
+				return nil, c.Err("names and template are mutually exclusive")
+			}
+			names = true
+			kps.mode = mode
+		case "template":
+			args := c.RemainingArgs()
+			if len(args) != 1 {
+				return nil, c.ArgErr()
+			}
+			if names {
+				return nil, c.Err("names and template are mutually exclusive")
+			}
+			t, err := parseTemplate(args[0])
+			if err != nil {
+				return nil, c.Errf("invalid template: %s", err)
+			}
+			tmpl = true
+			kps.mode = modeTemplate
+			kps.template = t
+		case "addresses":
+			args := c.RemainingArgs()
+			if len(args) == 0 {
+				return nil, c.ArgErr()
+			}
+			source, err := newAddressSource(args[0], args[1:])
+			if err != nil {
+				return nil, c.Errf("invalid addresses: %s", err)
+			}
+			kps.addresses = source
+		case "owner_records":
+			if len(c.RemainingArgs()) != 0 {
+				return nil, c.ArgErr()
+			}
+			kps.ownerRecords = true
+		case "label_records":
+			args := c.RemainingArgs()
+			if len(args) == 0 {
+				return nil, c.ArgErr()
+			}
+			for _, arg := range args {
+				name, key, err := parseLabelKey(arg)
+				if err != nil {
+					return nil, c.Err(err.Error())
+				}
+				if _, ok := kps.labelKeys[name]; ok {
+					return nil, c.Errf("duplicate label key name '%s'", name)
+				}
+				kps.labelKeys[name] = key
+			}
+		case "namespace_records":
+			args := c.RemainingArgs()
+			if len(args) > 1 {
+				return nil, c.ArgErr()
+			}
+			kps.namespaceRecords = defaultNamespaceRecords
+			if len(args) == 1 {
+				max, err := strconv.Atoi(args[0])
+				if err != nil || max < 1 {
+					return nil, c.Errf("namespace_records maximum must be a positive number: %s", args[0])
+				}
+				kps.namespaceRecords = max
+			}
+		case "ptr_zone":
+			args := c.RemainingArgs()
+			if len(args) != 1 {
+				return nil, c.ArgErr()
+			}
+			zones := plugin.Host(args[0]).NormalizeExact()
+			if len(zones) != 1 || plugin.Zones(kps.Zones).Matches(zones[0]) != zones[0] {
+				return nil, c.Errf("ptr_zone '%s' is not a zone of the plugin", args[0])
+			}
+			if isReverseZone(zones[0]) {
+				return nil, c.Errf("ptr_zone '%s' is not a forward zone", args[0])
+			}
+			kps.ptrZone = zones[0]
+		case "ptr_records":
+			args := c.RemainingArgs()
+			if len(args) != 1 {
+				return nil, c.ArgErr()
+			}
+			switch args[0] {
+			case "all":
+				kps.ptrCanonical = false
+			case "canonical":
+				kps.ptrCanonical = true
+			default:
+				return nil, c.Errf("unknown ptr_records policy '%s'", args[0])
+			}
+		case "serve":
+			args := c.RemainingArgs()
+			if len(args) != 1 {
+				return nil, c.ArgErr()
+			}
+			switch args[0] {
+			case "all":
+				kps.serve = serveAll
+			case "running":
+				kps.serve = serveRunning
+			case "ready":
+				kps.serve = serveReady
+			default:
+				return nil, c.Errf("unknown serve policy '%s'", args[0])
+			}
+		case "namespaces":
+			args := c.RemainingArgs()
+			if len(args) == 0 {
+				return nil, c.ArgErr()
 			}
+			for _, ns := range args {
+				kps.namespaces[ns] = true
+			}
+		case "ignore_namespaces":
+			args := c.RemainingArgs()
+			if len(args) == 0 {
+				return nil, c.ArgErr()
+			}
+			for _, ns := range args {
+				kps.ignoreNamespaces[ns] = true
+			}
+		case "labels":
+			args := c.RemainingArgs()
+			if len(args) == 0 {
+				return nil, c.ArgErr()
+			}
+			labelSelectorString := strings.Join(args, " ")
+			ls, err := meta.ParseToLabelSelector(labelSelectorString)
+			if err != nil {
+				return nil, c.Errf("unable to parse label selector value: '%v': %v", labelSelectorString, err)
+			}
+			kps.labelSelector, err = meta.LabelSelectorAsSelector(ls)
+			if err != nil {
+				return nil, c.Errf("unable to create label selector: '%v': %v", labelSelectorString, err)
+			}
+		case "node":
+			args := c.RemainingArgs()
+			switch len(args) {
+			case 0:
+				kps.node = os.Getenv("NODE_NAME")
+				if kps.node == "" {
+					return nil, c.Err("node name not given and NODE_NAME is not set")
+				}
+			case 1:
+				kps.node = args[0]
+			default:
+				return nil, c.ArgErr()
+			}
+		case "namespaced":
+			if len(c.RemainingArgs()) != 0 {
+				return nil, c.ArgErr()
+			}
+			kps.namespaced = true
+		case "unsynced":
+			args := c.RemainingArgs()
+			if len(args) == 0 {
+				return nil, c.ArgErr()
+			}
+			switch args[0] {
+			case "servfail", "fallthrough":
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				kps.unsynced = unsyncedServfail
+				if args[0] == "fallthrough" {
+					kps.unsynced = unsyncedFallthrough
+				}
+			case "wait":
+				if len(args) != 2 {
+					return nil, c.ArgErr()
+				}
+				d, err := time.ParseDuration(args[1])
+				if err != nil || d <= 0 {
+					return nil, c.Errf("invalid unsynced wait timeout '%s'", args[1])
+				}
+				kps.unsynced = unsyncedWait
+				kps.unsyncedTimeout = d
+			default:
+				return nil, c.Errf("unknown unsynced policy '%s'", args[0])
+			}
+		case "stale":
+			args := c.RemainingArgs()
+			if len(args) < 2 {
+				return nil, c.ArgErr()
+			}
+			switch args[0] {
+			case "serve":
+				if len(args) > 3 {
+					return nil, c.ArgErr()
+				}
+				kps.stalePolicy = staleServe
+				if len(args) == 3 {
+					t, err := strconv.Atoi(args[2])
+					if err != nil || t < 0 || t > 3600 {
+						return nil, c.Errf("stale ttl must be in range [0, 3600]: %s", args[2])
+					}
+					kps.staleTTL = uint32(t)
+				}
+			case "fail":
+				if len(args) != 2 {
+					return nil, c.ArgErr()
+				}
+				kps.stalePolicy = staleFail
+			default:
+				return nil, c.Errf("unknown stale policy '%s'", args[0])
+			}
+			d, err := time.ParseDuration(args[1])
+			if err != nil || d <= 0 {
+				return nil, c.Errf("invalid stale threshold '%s'", args[1])
+			}
+			kps.staleThreshold = d
+		case "file":
+			args := c.RemainingArgs()
+			if len(args) == 0 || len(args) > 2 {
+				return nil, c.ArgErr()
+			}
+			kps.podFile = args[0]
+			kps.podReload = defaultFileReload
+			if len(args) == 2 {
+				d, err := time.ParseDuration(args[1])
+				if err != nil || d < 0 {
+					return nil, c.Errf("invalid file reload interval '%s'", args[1])
+				}
+				kps.podReload = d
+			}
+		case "cluster":
+			args := c.RemainingArgs()
+			if len(args) == 0 || len(args) > 3 {
+				return nil, c.ArgErr()
+			}
+			if _, ok := dns.IsDomainName(args[0]); !ok || dns.CountLabel(args[0]) != 1 {
+				return nil, c.Errf("invalid cluster name '%s'", args[0])
+			}
+			name := strings.ToLower(args[0])
+			for _, cl := range clusters {
+				if cl[0] == name {
+					return nil, c.Errf("duplicate cluster '%s'", args[0])
+				}
+			}
+			cl := []string{name, "", ""}
+			copy(cl[1:], args[1:])
+			clusters = append(clusters, cl)
+		case "snapshot":
+			args := c.RemainingArgs()
+			if len(args) != 2 {
+				return nil, c.ArgErr()
+			}
+			d, err := time.ParseDuration(args[1])
+			if err != nil || d <= 0 {
+				return nil, c.Errf("invalid snapshot interval '%s'", args[1])
+			}
+			kps.snapshotFile = args[0]
+			kps.snapshotInterval = d
 		case "ttl":
 			args := c.RemainingArgs()
 			if len(args) == 0 {
@@ -110,7 +398,24 @@ func parseStanza(c *caddy.Controller) (*KubePods, error) {
 		}
 	}
 
-	if kps.mode != modeEchoIP {
+	if kps.namespaced && len(kps.namespaces) == 0 {
+		return nil, c.Err("namespaced requires namespaces")
+	}
+	if kps.ptrZone != "" && kps.zoneMode(kps.ptrZone) == modeEchoIP {
+		return nil, c.Errf("ptr_zone '%s' can't use names echo-ip", kps.ptrZone)
+	}
+	if len(clusters) > 0 {
+		for _, z := range kps.Zones {
+			if kps.zoneMode(z) == modeEchoIP {
+				return nil, c.Err("cluster can't be used with names echo-ip")
+			}
+		}
+		if kps.podFile != "" {
+			return nil, c.Err("cluster and file are mutually exclusive")
+		}
+	}
+
+	if !kps.echoOnly() {
 		// retrieve search zones for autopath
 		resolv, err := dns.ClientConfigFromFile("/etc/resolv.conf")
 		if err != nil {
@@ -120,81 +425,397 @@ func parseStanza(c *caddy.Controller) (*KubePods, error) {
 		kps.autoPathSearch = resolv.Search
 	}
 
+	// the clusters are created last, as they get the rest of the configuration
+	for _, cl := range clusters {
+		kps.clusters = append(kps.clusters, kps.newCluster(cl[0], cl[1], cl[2]))
+	}
+
 	return kps, nil
 }
 
 func (k *KubePods) setWatch(ctx context.Context) {
-	// define Pod controller and reverse lookup indexer
-	k.indexer, k.controller = cache.NewIndexerInformer(
-		&cache.ListWatch{
-			ListFunc: func(o meta.ListOptions) (runtime.Object, error) {
-				return k.client.CoreV1().Pods(core.NamespaceAll).List(ctx, o)
-			},
-			WatchFunc: func(o meta.ListOptions) (watch.Interface, error) {
-				return k.client.CoreV1().Pods(core.NamespaceAll).Watch(ctx, o)
-			},
+	if len(k.clusters) > 0 {
+		for _, c := range k.clusters {
+			c.setWatch(ctx)
+		}
+		return
+	}
+
+	if !k.namespaced {
+		// define Pod controller and reverse lookup indexer, the Pods are stored as podRecords
+		h := &watchHealth{}
+		k.health = []*watchHealth{h}
+		k.indexer, k.controller = object.NewIndexerInformer(h.track(k.podListWatch(ctx, core.NamespaceAll)), &core.Pod{}, k.eventHandler(), k.indexers(), object.DefaultProcessor(k.toPodRecord, nil))
+		go k.waitForSync()
+		return
+	}
+
+	// define a Pod controller and indexer per namespace
+	indexer := make(namespacedIndexer)
+	var controller namespacedController
+	for ns := range k.namespaces {
+		h := &watchHealth{}
+		k.health = append(k.health, h)
+		i, c := object.NewIndexerInformer(h.track(k.podListWatch(ctx, ns)), &core.Pod{}, k.eventHandler(), k.indexers(), object.DefaultProcessor(k.toPodRecord, nil))
+		indexer[ns] = i
+		controller = append(controller, c)
+	}
+	k.indexer, k.controller = indexer, controller
+	go k.waitForSync()
+}
+
+// indexers returns the indexers for Pod lookups.
+func (k *KubePods) indexers() cache.Indexers {
+	return cache.Indexers{
+		// reverse for reverse lookups, this includes Pods that are not served, as it
+		// also provides the client's identity for metadata and autopath
+		"reverse": func(obj interface{}) ([]string, error) {
+			pod, ok := obj.(*podRecord)
+			if !ok {
+				return nil, errors.New("unexpected obj type")
+			}
+			return pod.allIPs(), nil
 		},
-		&core.Pod{},
-		0,
-		cache.ResourceEventHandlerFuncs{},
-		cache.Indexers{
-			// reverse for reverse lookups
-			"reverse": func(obj interface{}) ([]string, error) {
-				pod, ok := obj.(*core.Pod)
-				if !ok {
-					return nil, errors.New("unexpected obj type")
-				}
-				var idx []string
-				for _, addr := range pod.Status.PodIPs {
-					idx = append(idx, addr.IP)
-				}
-				return idx, nil
-			},
-			// namespace for lookups without pod name
-			"namespace": func(obj interface{}) ([]string, error) {
-				pod, ok := obj.(*core.Pod)
-				if !ok {
-					return nil, errors.New("unexpected obj type")
+		// namespace for lookups without pod name
+		"namespace": func(obj interface{}) ([]string, error) {
+			pod, ok := obj.(*podRecord)
+			if !ok {
+				return nil, errors.New("unexpected obj type")
+			}
+			if !k.serves(pod) {
+				return nil, nil
+			}
+			return []string{pod.Namespace}, nil
+		},
+		// dashedip for lookups with dashed IP as name
+		"dashedip": func(obj interface{}) ([]string, error) {
+			pod, ok := obj.(*podRecord)
+			if !ok {
+				return nil, errors.New("unexpected obj type")
+			}
+			if !k.serves(pod) {
+				return nil, nil
+			}
+			var idx []string
+			for _, ip := range pod.IPs {
+				idx = append(idx, strings.Join([]string{pod.Namespace, dashIP(ip)}, "/"))
+			}
+			return idx, nil
+		},
+		// ent for the empty non-terminals of Pod names with dots, e.g. b.c of a.b.c, and of
+		// the hostname records, i.e. the subdomain
+		"ent": func(obj interface{}) ([]string, error) {
+			pod, ok := obj.(*podRecord)
+			if !ok {
+				return nil, errors.New("unexpected obj type")
+			}
+			if !k.serves(pod) {
+				return nil, nil
+			}
+			var idx []string
+			for _, name := range nameSuffixes(pod.Name) {
+				idx = append(idx, strings.Join([]string{pod.Namespace, name}, "/"))
+			}
+			if pod.Hostname != "" && pod.Subdomain != "" {
+				idx = append(idx, strings.Join([]string{pod.Namespace, pod.Subdomain}, "/"))
+			}
+			for _, n := range pod.Networks {
+				idx = append(idx, strings.Join([]string{pod.Namespace, n.Name}, "/"))
+				for _, name := range nameSuffixes(pod.Name) {
+					idx = append(idx, strings.Join([]string{pod.Namespace, name + "." + n.Name}, "/"))
 				}
-				return []string{pod.Namespace}, nil
-			},
-			// dashedip for lookups with dashed IP as name
-			"dashedip": func(obj interface{}) ([]string, error) {
-				pod, ok := obj.(*core.Pod)
-				if !ok {
-					return nil, errors.New("unexpected obj type")
+			}
+			return idx, nil
+		},
+		// owner for lookups of the Pods of a controller
+		"owner": func(obj interface{}) ([]string, error) {
+			pod, ok := obj.(*podRecord)
+			if !ok {
+				return nil, errors.New("unexpected obj type")
+			}
+			if !k.ownerServed(pod) {
+				return nil, nil
+			}
+			return []string{strings.Join([]string{pod.Namespace, pod.Owner.Kind, pod.Owner.Name}, "/")}, nil
+		},
+		// ownerent for the kind.namespace names above the names of the Pods of controllers
+		"ownerent": func(obj interface{}) ([]string, error) {
+			pod, ok := obj.(*podRecord)
+			if !ok {
+				return nil, errors.New("unexpected obj type")
+			}
+			if !k.ownerServed(pod) {
+				return nil, nil
+			}
+			return []string{strings.Join([]string{pod.Namespace, pod.Owner.Kind}, "/")}, nil
+		},
+		// label for lookups of the Pods with a label in label_records
+		"label": func(obj interface{}) ([]string, error) {
+			pod, ok := obj.(*podRecord)
+			if !ok {
+				return nil, errors.New("unexpected obj type")
+			}
+			if !k.serves(pod) {
+				return nil, nil
+			}
+			var idx []string
+			for name, value := range pod.Labels {
+				idx = append(idx, strings.Join([]string{pod.Namespace, name, value}, "/"))
+			}
+			return idx, nil
+		},
+		// labelent for the names above the names of the Pods with a label
+		"labelent": func(obj interface{}) ([]string, error) {
+			pod, ok := obj.(*podRecord)
+			if !ok {
+				return nil, errors.New("unexpected obj type")
+			}
+			if !k.serves(pod) || len(pod.Labels) == 0 {
+				return nil, nil
+			}
+			idx := []string{strings.Join([]string{pod.Namespace, labelLabel}, "/")}
+			for name, value := range pod.Labels {
+				idx = append(idx, strings.Join([]string{pod.Namespace, name + "." + labelLabel}, "/"))
+				for _, suffix := range nameSuffixes(value) {
+					idx = append(idx, strings.Join([]string{pod.Namespace, suffix + "." + name + "." + labelLabel}, "/"))
 				}
-				var idx []string
-				for _, addr := range pod.Status.PodIPs {
-					idx = append(idx, strings.Join([]string{pod.Namespace, dashIP(addr.IP)}, "/"))
+			}
+			return idx, nil
+		},
+		// network for lookups of the addresses on secondary networks
+		"network": func(obj interface{}) ([]string, error) {
+			pod, ok := obj.(*podRecord)
+			if !ok {
+				return nil, errors.New("unexpected obj type")
+			}
+			if !k.serves(pod) {
+				return nil, nil
+			}
+			var idx []string
+			for _, n := range pod.Networks {
+				idx = append(idx, strings.Join([]string{pod.Namespace, n.Name, pod.Name}, "/"))
+			}
+			return idx, nil
+		},
+		// hostname for lookups with the hostname and subdomain from the Pod's spec
+		"hostname": func(obj interface{}) ([]string, error) {
+			pod, ok := obj.(*podRecord)
+			if !ok {
+				return nil, errors.New("unexpected obj type")
+			}
+			if !k.serves(pod) {
+				return nil, nil
+			}
+			if pod.Hostname == "" || pod.Subdomain == "" {
+				return nil, nil
+			}
+			return []string{strings.Join([]string{pod.Namespace, pod.Subdomain, pod.Hostname}, "/")}, nil
+		},
+		// template for lookups with names built from the name template
+		"template": func(obj interface{}) ([]string, error) {
+			pod, ok := obj.(*podRecord)
+			if !ok {
+				return nil, errors.New("unexpected obj type")
+			}
+			if !k.serves(pod) {
+				return nil, nil
+			}
+			var idx []string
+			seen := make(map[string]bool)
+			for _, n := range pod.Names {
+				if !seen[n.Name] {
+					seen[n.Name] = true
+					idx = append(idx, n.Name)
 				}
-				return idx, nil
+			}
+			return idx, nil
+		},
+		// reverseent for the names of partial addresses in the reverse zones, which are empty non-terminals
+		"reverseent": func(obj interface{}) ([]string, error) {
+			pod, ok := obj.(*podRecord)
+			if !ok {
+				return nil, errors.New("unexpected obj type")
+			}
+			if !k.serves(pod) {
+				return nil, nil
+			}
+			var idx []string
+			seen := make(map[string]bool)
+			for _, ip := range pod.allIPs() {
+				rev, err := dns.ReverseAddr(ip)
+				if err != nil {
+					continue
+				}
+				for _, name := range nameSuffixes(rev) {
+					if name != "" && !seen[name] {
+						seen[name] = true
+						idx = append(idx, name)
+					}
+				}
+			}
+			return idx, nil
+		},
+		// templateent for the empty non-terminals of the names built from the name template
+		"templateent": func(obj interface{}) ([]string, error) {
+			pod, ok := obj.(*podRecord)
+			if !ok {
+				return nil, errors.New("unexpected obj type")
+			}
+			if !k.serves(pod) {
+				return nil, nil
+			}
+			var idx []string
+			seen := make(map[string]bool)
+			for _, n := range pod.Names {
+				for _, name := range nameSuffixes(n.Name) {
+					if !seen[name] {
+						seen[name] = true
+						idx = append(idx, name)
+					}
+				}
+			}
+			return idx, nil
+		},
+	}
+}
+
+// nameSuffixes returns the names formed by the last labels of name, e.g. b.c and c for a.b.c.
+func nameSuffixes(name string) (suffixes []string) {
+	for i, c := range name {
+		if c == '.' {
+			suffixes = append(suffixes, name[i+1:])
+		}
+	}
+	return suffixes
+}
+
+// podListWatch returns the ListWatch for the Pods in namespace, restricted to the selected
+// namespaces and labels. The Pods are read from the Pod file if there is one.
+func (k *KubePods) podListWatch(ctx context.Context, namespace string) *cache.ListWatch {
+	if k.podFile != "" {
+		f := &podFile{
+			path:   k.podFile,
+			reload: k.podReload,
+			selected: func(pod *core.Pod) bool {
+				if namespace != core.NamespaceAll && pod.Namespace != namespace {
+					return false
+				}
+				if k.labelSelector != nil && !k.labelSelector.Matches(labels.Set(pod.Labels)) {
+					return false
+				}
+				return k.podSelected(pod)
 			},
+		}
+		return f.listWatch()
+	}
+
+	var selectors []fields.Selector
+	if len(k.namespaces) == 1 {
+		for ns := range k.namespaces {
+			selectors = append(selectors, fields.OneTermEqualSelector("metadata.namespace", ns))
+		}
+	}
+	for ns := range k.ignoreNamespaces {
+		selectors = append(selectors, fields.OneTermNotEqualSelector("metadata.namespace", ns))
+	}
+	if k.node != "" {
+		selectors = append(selectors, fields.OneTermEqualSelector("spec.nodeName", k.node))
+	}
+	fieldSelector := fields.AndSelectors(selectors...).String()
+
+	labelSelector := ""
+	if k.labelSelector != nil {
+		labelSelector = k.labelSelector.String()
+	}
+
+	// Multiple namespaces can't be selected with a field selector, so Pods that are not selected are
+	// dropped before they are cached.
+	filter := len(k.namespaces) > 0 || len(k.ignoreNamespaces) > 0 || k.node != ""
+
+	return &cache.ListWatch{
+		ListFunc: func(o meta.ListOptions) (runtime.Object, error) {
+			o.FieldSelector = fieldSelector
+			o.LabelSelector = labelSelector
+			list, err := k.client.CoreV1().Pods(namespace).List(ctx, o)
+			if err != nil || !filter {
+				return list, err
+			}
+			items := list.Items[:0]
+			for _, pod := range list.Items {
+				if k.podSelected(&pod) {
+					items = append(items, pod)
+				}
+			}
+			list.Items = items
+			return list, nil
 		},
-	)
+		WatchFunc: func(o meta.ListOptions) (watch.Interface, error) {
+			o.FieldSelector = fieldSelector
+			o.LabelSelector = labelSelector
+			w, err := k.client.CoreV1().Pods(namespace).Watch(ctx, o)
+			if err != nil || !filter {
+				return w, err
+			}
+			return watch.Filter(w, func(e watch.Event) (watch.Event, bool) {
+				if pod, ok := e.Object.(*core.Pod); ok {
+					return e, k.podSelected(pod)
+				}
+				return e, true
+			}), nil
+		},
+	}
 }
 
 func startWatch(k *KubePods, config *dnsserver.Config) func() error {
 	return func() error {
-		// retrieve client from kubeapi plugin
-		var err error
-		k.client, err = kubeapi.Client(config)
-		if err != nil {
-			return err
+		for _, c := range k.clusters {
+			var err error
+			c.client, err = c.connect(config)
+			if err != nil {
+				return fmt.Errorf("cluster %s: %s", c.name, err)
+			}
+			c.run(config)
+		}
+		if len(k.clusters) > 0 {
+			return nil
 		}
 
-		// start the informer
-		go k.controller.Run(k.stopCh)
+		// retrieve client from kubeapi plugin, unless the Pods are read from a file
+		if k.podFile == "" {
+			var err error
+			k.client, err = kubeapi.Client(config)
+			if err != nil {
+				return err
+			}
+		}
+		k.run(config)
 		return nil
 	}
 }
 
+// run starts the informer, and saving snapshots and sending notifies if configured.
+func (k *KubePods) run(config *dnsserver.Config) {
+	// start the informer
+	go k.controller.Run(k.stopCh)
+
+	if k.snapshotFile != "" {
+		go k.saveSnapshots()
+	}
+
+	// send notifies on changes if the transfer plugin is used
+	if t, ok := config.Handler("transfer").(*transfer.Transfer); ok {
+		go k.notify(t)
+	}
+}
+
 func stopWatch(k *KubePods) func() error {
 	return func() error {
 		k.stopLock.Lock()
 		defer k.stopLock.Unlock()
 		if !k.shutdown {
-			close(k.stopCh)
+			for _, s := range k.sources() {
+				s.stop()
+			}
 			k.shutdown = true
 			return nil
 		}
@@ -202,6 +823,18 @@ func stopWatch(k *KubePods) func() error {
 	}
 }
 
+// stop saves the snapshot and stops the informer.
+func (k *KubePods) stop() {
+	if k.snapshotFile != "" {
+		if err := k.saveSnapshot(); err != nil {
+			log.Warningf("Failed to save snapshot %q: %s", k.snapshotFile, err)
+		}
+	}
+	close(k.stopCh)
+	// the cache is gone with the controller
+	k.countPods(-int(atomic.LoadInt64(&k.podCount)), -int(atomic.LoadInt64(&k.ipCount)))
+}
+
 func undashIP(name string) (ip string) {
 	if strings.Count(name, "-") == 3 && !strings.Contains(name, "--") {
 		ip = strings.ReplaceAll(name, "-", ".")
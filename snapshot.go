@@ -0,0 +1,128 @@
+package kubepods
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// snapshot is what is saved to the snapshot file.
+type snapshot struct {
+	Pods []*podRecord
+}
+
+// loadSnapshot adds the Pods saved in the snapshot file to the cache, so they can be served until
+// the initial list of Pods has been received. The informer removes the Pods that no longer exist
+// when it lists the Pods.
+func (k *KubePods) loadSnapshot() error {
+	data, err := os.ReadFile(k.snapshotFile)
+	if err != nil {
+		return err
+	}
+	var s snapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	for _, pod := range s.Pods {
+		if err := k.indexer.Add(pod); err != nil {
+			return err
+		}
+	}
+	items, ips := k.indexer.List(), 0
+	for _, obj := range items {
+		if pod, ok := obj.(*podRecord); ok {
+			ips += len(pod.IPs)
+		}
+	}
+	k.countPods(len(items), ips)
+	atomic.StoreInt32(&k.snapshotLoaded, 1)
+	log.Infof("Loaded %d Pods from snapshot %q", len(s.Pods), k.snapshotFile)
+	return nil
+}
+
+// saveSnapshot saves the cached Pods to the snapshot file. Nothing is saved until the cache has
+// synced, as it may still hold the Pods of an older snapshot.
+func (k *KubePods) saveSnapshot() error {
+	if atomic.LoadInt32(&k.synced) == 0 {
+		return nil
+	}
+	var s snapshot
+	for _, obj := range k.indexer.List() {
+		if pod, ok := obj.(*podRecord); ok {
+			s.Pods = append(s.Pods, pod)
+		}
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	// write to a temporary file first, so an interrupted save doesn't leave a partial snapshot
+	f, err := os.CreateTemp(filepath.Dir(k.snapshotFile), filepath.Base(k.snapshotFile)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), k.snapshotFile); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
+
+// saveSnapshots saves the cached Pods to the snapshot file every snapshotInterval.
+func (k *KubePods) saveSnapshots() {
+	ticker := time.NewTicker(k.snapshotInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-k.stopCh:
+			return
+		case <-ticker.C:
+			if err := k.saveSnapshot(); err != nil {
+				log.Warningf("Failed to save snapshot %q: %s", k.snapshotFile, err)
+			}
+		}
+	}
+}
+
+// stale returns true if answers come from a snapshot, because the initial list of Pods has not
+// been received yet. With clusters, it is true if it is for any cluster.
+func (k *KubePods) stale() bool {
+	for _, s := range k.sources() {
+		if atomic.LoadInt32(&s.snapshotLoaded) == 1 && atomic.LoadInt32(&s.synced) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// markStale adds an Extended DNS Error to m saying that the answer is stale, with text as the
+// reason, if the client supports EDNS.
+func markStale(r, m *dns.Msg, text string) {
+	o := r.IsEdns0()
+	if o == nil {
+		return
+	}
+	opt := new(dns.OPT)
+	opt.Hdr.Name = "."
+	opt.Hdr.Rrtype = dns.TypeOPT
+	opt.SetUDPSize(o.UDPSize())
+	if o.Do() {
+		opt.SetDo()
+	}
+	opt.Option = append(opt.Option, &dns.EDNS0_EDE{InfoCode: dns.ExtendedErrorCodeStaleAnswer, ExtraText: text})
+	m.Extra = append(m.Extra, opt)
+}
@@ -0,0 +1,117 @@
+package kubepods
+
+import (
+	"context"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+)
+
+func TestSnapshot(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "pods.json")
+	ctx := context.Background()
+
+	// save the Pods of a synced cache
+	k := New([]string{"cluster.local.", "in-addr.arpa."})
+	k.mode = modeName
+	k.snapshotFile = file
+	k.client = fake.NewSimpleClientset()
+	addFixtures(ctx, k)
+	k.setWatch(ctx)
+	if err := k.loadSnapshot(); err == nil {
+		t.Error("Expected error loading a missing snapshot")
+	}
+	go k.controller.Run(k.stopCh)
+	for atomic.LoadInt32(&k.synced) == 0 {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if err := k.saveSnapshot(); err != nil {
+		t.Fatalf("Failed to save snapshot: %v", err)
+	}
+	close(k.stopCh)
+
+	// load them in a new cache, with pod1 deleted in the meantime
+	k = New([]string{"cluster.local.", "in-addr.arpa."})
+	k.mode = modeName
+	k.snapshotFile = file
+	k.client = fake.NewSimpleClientset()
+	addFixtures(ctx, k)
+	k.client.CoreV1().Pods("namespace1").Delete(ctx, "pod1", meta.DeleteOptions{})
+	k.setWatch(ctx)
+	if err := k.loadSnapshot(); err != nil {
+		t.Fatalf("Failed to load snapshot: %v", err)
+	}
+	if !k.Ready() {
+		t.Error("Expected ready with a snapshot")
+	}
+
+	// stale answers from the snapshot
+	m := snapshotQuery(t, k, "pod1.namespace1.cluster.local.", true)
+	if m.Rcode != dns.RcodeSuccess || len(m.Answer) != 2 {
+		t.Fatalf("Expected an answer from the snapshot, got %v", m)
+	}
+	if !isStale(m) {
+		t.Errorf("Expected a stale answer, got %v", m)
+	}
+	if m := snapshotQuery(t, k, "pod1.namespace1.cluster.local.", false); m.IsEdns0() != nil {
+		t.Errorf("Expected no OPT record without EDNS, got %v", m)
+	}
+	if m := snapshotQuery(t, k, "3.0.0.10.in-addr.arpa.", true); len(m.Answer) != 2 || !isStale(m) {
+		t.Errorf("Expected PTR from the snapshot, got %v", m)
+	}
+
+	// the informer replaces the snapshot
+	go k.controller.Run(k.stopCh)
+	defer close(k.stopCh)
+	for atomic.LoadInt32(&k.synced) == 0 {
+		time.Sleep(100 * time.Millisecond)
+	}
+	m = snapshotQuery(t, k, "pod1.namespace1.cluster.local.", true)
+	if m.Rcode != dns.RcodeNameError {
+		t.Errorf("Expected NXDOMAIN for a deleted Pod, got %v", m)
+	}
+	if isStale(m) {
+		t.Errorf("Expected a fresh answer, got %v", m)
+	}
+	if m := snapshotQuery(t, k, "pod2.namespace2.cluster.local.", true); m.Rcode != dns.RcodeSuccess || isStale(m) {
+		t.Errorf("Expected a fresh answer, got %v", m)
+	}
+}
+
+func snapshotQuery(t *testing.T, k *KubePods, qname string, edns bool) *dns.Msg {
+	r := new(dns.Msg)
+	qtype := dns.TypeA
+	if dns.IsSubDomain("in-addr.arpa.", qname) {
+		qtype = dns.TypePTR
+	}
+	r.SetQuestion(qname, qtype)
+	if edns {
+		r.SetEdns0(4096, false)
+	}
+	w := dnstest.NewRecorder(&test.ResponseWriter{})
+	if _, err := k.ServeDNS(context.Background(), w, r); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return w.Msg
+}
+
+func isStale(m *dns.Msg) bool {
+	opt := m.IsEdns0()
+	if opt == nil {
+		return false
+	}
+	for _, o := range opt.Option {
+		if ede, ok := o.(*dns.EDNS0_EDE); ok && ede.InfoCode == dns.ExtendedErrorCodeStaleAnswer {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,100 @@
+package kubepods
+
+import (
+	"context"
+	"strings"
+
+	"github.com/miekg/dns"
+
+	"github.com/coredns/coredns/plugin/pkg/dnsutil"
+	"github.com/coredns/coredns/request"
+)
+
+// serveSRV answers queries for _port._proto.pod.namespace names from the Pod's named container ports,
+// and for their _proto.pod.namespace parents. podSegments has at least 3 labels, as the Pod's name can
+// have dots.
+func (k *KubePods) serveSRV(ctx context.Context, state request.Request, mode int, podSegments []string) (int, error) {
+	portName, proto := podSegments[0], podSegments[1]
+	if !strings.HasPrefix(portName, "_") {
+		return k.nxdomain(ctx, state)
+	}
+	if !strings.HasPrefix(proto, "_") || len(podSegments) < 4 {
+		return k.serveSRVProto(ctx, state, mode, podSegments)
+	}
+	portName, proto = portName[1:], proto[1:]
+
+	// the Pod's name can have dots
+	name, namespace := strings.Join(podSegments[2:len(podSegments)-1], "."), podSegments[len(podSegments)-1]
+	items, err := k.podsByName(name, namespace, mode)
+	if err != nil {
+		return dns.RcodeServerFailure, err
+	}
+	pods, err := k.servedPods(items)
+	if err != nil {
+		return dns.RcodeServerFailure, err
+	}
+
+	target := dnsutil.Join(name, namespace, state.Zone)
+
+	var records, extra []dns.RR
+	for _, pod := range pods {
+		found := false
+		for _, port := range containerPorts(pod, portName, proto) {
+			found = true
+			records = append(records, &dns.SRV{
+				Hdr:      dns.RR_Header{Name: state.QName(), Rrtype: dns.TypeSRV, Class: dns.ClassINET, Ttl: k.ttl},
+				Priority: 0,
+				Weight:   100,
+				Port:     uint16(port.Port),
+				Target:   target,
+			})
+		}
+		if found {
+			extra = append(extra, k.addressRecords(target, dns.TypeA, pod)...)
+			extra = append(extra, k.addressRecords(target, dns.TypeAAAA, pod)...)
+		}
+	}
+
+	if len(records) == 0 {
+		return k.nxdomain(ctx, state)
+	}
+	if state.QType() != dns.TypeSRV {
+		return k.nodata(state)
+	}
+
+	k.writeResponse(state.W, state.Req, records, extra, nil, dns.RcodeSuccess)
+	return dns.RcodeSuccess, nil
+}
+
+// serveSRVProto answers queries for _proto.pod.namespace names, which are empty non-terminals if the
+// Pod has named container ports with the protocol.
+func (k *KubePods) serveSRVProto(ctx context.Context, state request.Request, mode int, podSegments []string) (int, error) {
+	proto := podSegments[0][1:]
+	name, namespace := strings.Join(podSegments[1:len(podSegments)-1], "."), podSegments[len(podSegments)-1]
+	items, err := k.podsByName(name, namespace, mode)
+	if err != nil {
+		return dns.RcodeServerFailure, err
+	}
+	pods, err := k.servedPods(items)
+	if err != nil {
+		return dns.RcodeServerFailure, err
+	}
+	for _, pod := range pods {
+		for _, p := range pod.Ports {
+			if strings.EqualFold(p.Protocol, proto) {
+				return k.nodata(state)
+			}
+		}
+	}
+	return k.nxdomain(ctx, state)
+}
+
+// containerPorts returns the ports of pod's containers that have the given name and protocol.
+func containerPorts(pod *podRecord, name, proto string) (ports []podPort) {
+	for _, p := range pod.Ports {
+		if strings.EqualFold(p.Name, name) && strings.EqualFold(p.Protocol, proto) {
+			ports = append(ports, p)
+		}
+	}
+	return ports
+}
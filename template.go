@@ -0,0 +1,138 @@
+package kubepods
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/miekg/dns"
+	core "k8s.io/api/core/v1"
+
+	"github.com/coredns/coredns/request"
+)
+
+// podIndexLabel is the label set by the StatefulSet controller with the Pod's ordinal.
+const podIndexLabel = "apps.kubernetes.io/pod-index"
+
+// templateData is what a name template is executed on: the Pod and one of its addresses.
+type templateData struct {
+	*core.Pod
+	IP string
+}
+
+var templateFuncs = template.FuncMap{
+	"dashed":  dashIP,
+	"ordinal": ordinal,
+	"owner":   owner,
+}
+
+// parseTemplate parses a name template.
+func parseTemplate(text string) (*template.Template, error) {
+	return template.New("name").Option("missingkey=zero").Funcs(templateFuncs).Parse(text)
+}
+
+// templateName is a name built from a template, and the address it was built with.
+type templateName struct {
+	Name string // relative to the zone, without trailing dot
+	IP   string
+}
+
+// templateNames executes the template for each of the Pod's addresses ips. Results that are not
+// valid domain names are dropped.
+func (k *KubePods) templateNames(pod *core.Pod, ips []string) (names []templateName) {
+	if k.template == nil {
+		return nil
+	}
+	var buf bytes.Buffer
+	for _, ip := range ips {
+		buf.Reset()
+		if err := k.template.Execute(&buf, templateData{Pod: pod, IP: ip}); err != nil {
+			log.Debugf("Failed to execute name template for Pod %s/%s: %s", pod.Namespace, pod.Name, err)
+			continue
+		}
+		name := strings.Trim(strings.ToLower(strings.TrimSpace(buf.String())), ".")
+		if name == "" {
+			continue
+		}
+		if _, ok := dns.IsDomainName(name); !ok {
+			log.Debugf("Name template for Pod %s/%s gave invalid name %q", pod.Namespace, pod.Name, name)
+			continue
+		}
+		names = append(names, templateName{Name: name, IP: ip})
+	}
+	return names
+}
+
+// serveTemplate answers queries for names built from the name template.
+func (k *KubePods) serveTemplate(ctx context.Context, state request.Request, podDomain string) (int, error) {
+	items, err := k.indexer.ByIndex("template", podDomain)
+	if err != nil {
+		return dns.RcodeServerFailure, err
+	}
+	pods, err := k.servedPods(items)
+	if err != nil {
+		return dns.RcodeServerFailure, err
+	}
+	if len(pods) == 0 {
+		// the name is an empty non-terminal if it is the end of a name with more labels
+		ents, err := k.indexer.ByIndex("templateent", podDomain)
+		if err != nil {
+			return dns.RcodeServerFailure, err
+		}
+		if len(ents) > 0 {
+			return k.nodata(state)
+		}
+		ent, err := k.groupENT(podDomain)
+		if err != nil {
+			return dns.RcodeServerFailure, err
+		}
+		if ent {
+			return k.nodata(state)
+		}
+		return k.nxdomain(ctx, state)
+	}
+
+	var records []dns.RR
+	for _, pod := range pods {
+		var ips []string
+		for _, n := range pod.Names {
+			if n.Name == podDomain {
+				ips = append(ips, n.IP)
+			}
+		}
+		records = append(records, k.ipRecords(state.QName(), state.QType(), ips)...)
+	}
+	if len(records) == 0 {
+		return k.nodata(state)
+	}
+
+	k.writeResponse(state.W, state.Req, records, nil, nil, dns.RcodeSuccess)
+	return dns.RcodeSuccess, nil
+}
+
+// ordinal returns the Pod's ordinal in its StatefulSet, or an empty string if there is none.
+func ordinal(pod *core.Pod) string {
+	if i, ok := pod.Labels[podIndexLabel]; ok {
+		return i
+	}
+	i := strings.LastIndex(pod.Name, "-")
+	if i < 0 {
+		return ""
+	}
+	if _, err := strconv.Atoi(pod.Name[i+1:]); err != nil {
+		return ""
+	}
+	return pod.Name[i+1:]
+}
+
+// owner returns the name of the Pod's controller, or an empty string if there is none.
+func owner(pod *core.Pod) string {
+	for _, ref := range pod.OwnerReferences {
+		if ref.Controller != nil && *ref.Controller {
+			return ref.Name
+		}
+	}
+	return ""
+}
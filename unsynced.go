@@ -0,0 +1,45 @@
+package kubepods
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/request"
+)
+
+// hasSynced returns true if queries can be answered from the Pod cache, because the initial list
+// of Pods or a snapshot is in the cache.
+func (k *KubePods) hasSynced() bool {
+	return atomic.LoadInt32(&k.synced) == 1 || atomic.LoadInt32(&k.snapshotLoaded) == 1
+}
+
+// serveUnsynced handles a query received before the Pod cache has synced, according to the
+// unsynced policy. It returns false if the query should be answered from the cache.
+func (k *KubePods) serveUnsynced(ctx context.Context, state request.Request) (int, bool, error) {
+	switch k.unsynced {
+	case unsyncedServfail:
+		unsyncedQueries.WithLabelValues("servfail").Inc()
+		return dns.RcodeServerFailure, true, nil
+	case unsyncedFallthrough:
+		unsyncedQueries.WithLabelValues("fallthrough").Inc()
+		rcode, err := plugin.NextOrFailure(k.Name(), k.Next, ctx, state.W, state.Req)
+		return rcode, true, err
+	case unsyncedWait:
+		timer := time.NewTimer(k.unsyncedTimeout)
+		defer timer.Stop()
+		select {
+		case <-k.syncedCh:
+			unsyncedQueries.WithLabelValues("wait").Inc()
+			return 0, false, nil
+		case <-timer.C:
+		case <-ctx.Done():
+		}
+		unsyncedQueries.WithLabelValues("timeout").Inc()
+		return dns.RcodeServerFailure, true, nil
+	}
+	return 0, false, nil
+}
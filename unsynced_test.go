@@ -0,0 +1,61 @@
+package kubepods
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+)
+
+func TestUnsynced(t *testing.T) {
+	tests := []struct {
+		unsynced int
+		timeout  time.Duration
+		run      bool // run the informer while the query waits
+		rcode    int
+		outcome  string
+	}{
+		{unsynced: unsyncedServfail, rcode: dns.RcodeServerFailure, outcome: "servfail"},
+		{unsynced: unsyncedFallthrough, rcode: dns.RcodeRefused, outcome: "fallthrough"},
+		{unsynced: unsyncedWait, timeout: 100 * time.Millisecond, rcode: dns.RcodeServerFailure, outcome: "timeout"},
+		{unsynced: unsyncedWait, timeout: 10 * time.Second, run: true, rcode: dns.RcodeSuccess, outcome: "wait"},
+	}
+
+	ctx := context.Background()
+	for _, tc := range tests {
+		k := New([]string{"cluster.local."})
+		k.mode = modeName
+		k.unsynced = tc.unsynced
+		k.unsyncedTimeout = tc.timeout
+		k.Next = test.NextHandler(dns.RcodeRefused, nil)
+		k.client = fake.NewSimpleClientset()
+		addFixtures(ctx, k)
+		k.setWatch(ctx)
+		if tc.run {
+			go k.controller.Run(k.stopCh)
+		}
+
+		outcomes := testutil.ToFloat64(unsyncedQueries.WithLabelValues(tc.outcome))
+
+		r := new(dns.Msg)
+		r.SetQuestion("pod1.namespace1.cluster.local.", dns.TypeA)
+		w := dnstest.NewRecorder(&test.ResponseWriter{})
+		rcode, err := k.ServeDNS(ctx, w, r)
+		if err != nil {
+			t.Errorf("Unexpected error for outcome %q: %v", tc.outcome, err)
+		}
+		if rcode != tc.rcode {
+			t.Errorf("Expected rcode %d for outcome %q, got %d", tc.rcode, tc.outcome, rcode)
+		}
+		if c := testutil.ToFloat64(unsyncedQueries.WithLabelValues(tc.outcome)); c != outcomes+1 {
+			t.Errorf("Expected outcome %q to be counted", tc.outcome)
+		}
+		close(k.stopCh)
+	}
+}
@@ -0,0 +1,446 @@
+package kubepods
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/pkg/dnsutil"
+	"github.com/coredns/coredns/plugin/transfer"
+)
+
+// journalSize is the number of Pod changes kept for incremental zone transfers.
+const journalSize = 1000
+
+// change is a journal entry describing one Pod change. Either old or new is nil for added and deleted Pods.
+type change struct {
+	serial   uint32 // serial of the zone before the change
+	old, new *podRecord
+}
+
+// Transfer implements the transfer.Transferer interface.
+func (k *KubePods) Transfer(zone string, serial uint32) (<-chan []dns.RR, error) {
+	for _, c := range k.clusters {
+		// the subzones of the clusters can be transferred
+		if plugin.Zones(c.Zones).Matches(zone) == zone {
+			return c.Transfer(zone, serial)
+		}
+	}
+	match := plugin.Zones(k.Zones).Matches(zone)
+	if match == "" || match != zone || len(k.clusters) > 0 {
+		return nil, transfer.ErrNotAuthoritative
+	}
+	if k.zoneMode(zone) == modeEchoIP {
+		// in echo mode the zone contents are unbounded
+		return nil, transfer.ErrNotAuthoritative
+	}
+
+	k.journalLock.Lock()
+	current := k.serial
+	var changes []change
+	// the PTR records of an address depend on all Pods that share it, so reverse zones are
+	// transferred in full
+	if serial != 0 && serial < current && !isReverseZone(zone) {
+		for i, c := range k.journal {
+			if c.serial == serial {
+				changes = append(changes, k.journal[i:]...)
+				break
+			}
+		}
+	}
+	k.journalLock.Unlock()
+
+	soa := k.soa(zone)
+	soa.Serial = current
+
+	ch := make(chan []dns.RR)
+	go func() {
+		defer close(ch)
+
+		// up to date, only send the SOA
+		if serial != 0 && serial >= current {
+			ch <- []dns.RR{soa}
+			return
+		}
+
+		// incremental transfer from the journal
+		if len(changes) > 0 {
+			ch <- []dns.RR{soa}
+			for i, c := range changes {
+				next := current
+				if i+1 < len(changes) {
+					next = changes[i+1].serial
+				}
+				deleted, added := k.zoneDiff(zone, c.old, c.new)
+				from := dns.Copy(soa).(*dns.SOA)
+				from.Serial = c.serial
+				to := dns.Copy(soa).(*dns.SOA)
+				to.Serial = next
+				ch <- append([]dns.RR{from}, deleted...)
+				ch <- append([]dns.RR{to}, added...)
+			}
+			ch <- []dns.RR{soa}
+			return
+		}
+
+		// full transfer, also the fallback when the journal doesn't reach back to serial
+		ch <- []dns.RR{soa}
+		ch <- []dns.RR{&dns.NS{Hdr: dns.RR_Header{Name: zone, Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: k.ttl}, Ns: soa.Ns}}
+
+		pods := k.indexer.List()
+		sort.Slice(pods, func(i, j int) bool {
+			pi, pj := pods[i].(*podRecord), pods[j].(*podRecord)
+			if pi.Namespace != pj.Namespace {
+				return pi.Namespace < pj.Namespace
+			}
+			return pi.Name < pj.Name
+		})
+		if isReverseZone(zone) {
+			if records := k.reverseZoneRecords(zone, pods); len(records) > 0 {
+				ch <- records
+			}
+			ch <- []dns.RR{soa}
+			return
+		}
+		// Pods with the same address can have the same records, e.g. for dashed IPs
+		seen := make(map[string]bool)
+		for _, obj := range pods {
+			pod, ok := obj.(*podRecord)
+			if !ok {
+				continue
+			}
+			var records []dns.RR
+			for _, rr := range k.zoneRecords(zone, pod) {
+				if key := rr.String(); !seen[key] {
+					seen[key] = true
+					records = append(records, rr)
+				}
+			}
+			if len(records) > 0 {
+				ch <- records
+			}
+		}
+		ch <- []dns.RR{soa}
+	}()
+
+	return ch, nil
+}
+
+// zoneRecords returns all records that pod contributes to zone. In reverse zones these are the
+// PTR records of all of pod's addresses, whether or not pod is preferred for them.
+func (k *KubePods) zoneRecords(zone string, pod *podRecord) (records []dns.RR) {
+	if pod == nil || !k.serves(pod) {
+		return nil
+	}
+
+	if isReverseZone(zone) {
+		for _, ip := range pod.allIPs() {
+			name, err := dns.ReverseAddr(ip)
+			if err != nil || !dns.IsSubDomain(zone, name) {
+				continue
+			}
+			records = append(records, k.ptr(name, ip, pod)...)
+		}
+		return records
+	}
+
+	if k.ownerServed(pod) {
+		name := dnsutil.Join(pod.Owner.Name, pod.Owner.Kind, pod.Namespace, zone)
+		records = append(records, k.addressRecords(name, dns.TypeA, pod)...)
+		records = append(records, k.addressRecords(name, dns.TypeAAAA, pod)...)
+	}
+
+	for key, value := range pod.Labels {
+		name := dnsutil.Join(value, key, labelLabel, pod.Namespace, zone)
+		records = append(records, k.addressRecords(name, dns.TypeA, pod)...)
+		records = append(records, k.addressRecords(name, dns.TypeAAAA, pod)...)
+	}
+
+	mode := k.zoneMode(zone)
+	if mode == modeTemplate {
+		for _, n := range pod.Names {
+			name := dnsutil.Join(n.Name, zone)
+			records = append(records, k.ipRecords(name, dns.TypeA, []string{n.IP})...)
+			records = append(records, k.ipRecords(name, dns.TypeAAAA, []string{n.IP})...)
+		}
+		return records
+	}
+
+	// the Pod's names carry the address records and the SRV records for the named container ports
+	var names []string
+	if mode == modeName || mode == modeNameAndIP {
+		names = append(names, dnsutil.Join(pod.Name, pod.Namespace, zone))
+	}
+	if mode == modeIP || mode == modeNameAndIP {
+		for _, ip := range pod.IPs {
+			names = append(names, dnsutil.Join(dashIP(ip), pod.Namespace, zone))
+		}
+	}
+	for _, name := range names {
+		records = append(records, k.addressRecords(name, dns.TypeA, pod)...)
+		records = append(records, k.addressRecords(name, dns.TypeAAAA, pod)...)
+		for _, p := range pod.Ports {
+			records = append(records, &dns.SRV{
+				Hdr:      dns.RR_Header{Name: dnsutil.Join("_"+p.Name, "_"+p.Protocol, name), Rrtype: dns.TypeSRV, Class: dns.ClassINET, Ttl: k.ttl},
+				Priority: 0,
+				Weight:   100,
+				Port:     uint16(p.Port),
+				Target:   name,
+			})
+		}
+	}
+
+	if (mode == modeName || mode == modeNameAndIP) && pod.Hostname != "" && pod.Subdomain != "" {
+		name := dnsutil.Join(pod.Hostname, pod.Subdomain, pod.Namespace, zone)
+		records = append(records, k.addressRecords(name, dns.TypeA, pod)...)
+		records = append(records, k.addressRecords(name, dns.TypeAAAA, pod)...)
+	}
+	if mode == modeName || mode == modeNameAndIP {
+		for _, n := range pod.Networks {
+			name := dnsutil.Join(pod.Name, n.Name, pod.Namespace, zone)
+			records = append(records, k.ipRecords(name, dns.TypeA, n.IPs)...)
+			records = append(records, k.ipRecords(name, dns.TypeAAAA, n.IPs)...)
+		}
+	}
+	return records
+}
+
+// reverseZoneRecords returns the PTR records of the reverse zone for pods. An address shared by
+// several Pods only has the records of the preferred Pod, as in lookups.
+func (k *KubePods) reverseZoneRecords(zone string, pods []interface{}) (records []dns.RR) {
+	var ips []string
+	preferred := make(map[string]*podRecord)
+	for _, obj := range pods {
+		pod, ok := obj.(*podRecord)
+		if !ok || !k.serves(pod) {
+			continue
+		}
+		for _, ip := range pod.allIPs() {
+			best, ok := preferred[ip]
+			if !ok {
+				ips = append(ips, ip)
+			}
+			if !ok || preferPod(pod, best) {
+				preferred[ip] = pod
+			}
+		}
+	}
+	for _, ip := range ips {
+		name, err := dns.ReverseAddr(ip)
+		if err != nil || !dns.IsSubDomain(zone, name) {
+			continue
+		}
+		records = append(records, k.ptr(name, ip, preferred[ip])...)
+	}
+	return records
+}
+
+// isReverseZone returns true if zone is in the in-addr.arpa. or ip6.arpa. domains.
+func isReverseZone(zone string) bool {
+	return dns.IsSubDomain("in-addr.arpa.", zone) || dns.IsSubDomain("ip6.arpa.", zone)
+}
+
+// zoneDiff returns the records of zone deleted and added by a change of a Pod from old to new,
+// either of which can be nil. Records that other served Pods with the same addresses also have,
+// e.g. for dashed IPs, stay in the zone and are left out.
+func (k *KubePods) zoneDiff(zone string, old, new *podRecord) (deleted, added []dns.RR) {
+	deleted, added = diffRecords(k.zoneRecords(zone, old), k.zoneRecords(zone, new))
+	if len(deleted) == 0 && len(added) == 0 {
+		return nil, nil
+	}
+	shared := k.sharedRecords(zone, old, new)
+	if len(shared) == 0 {
+		return deleted, added
+	}
+	return unshared(deleted, shared), unshared(added, shared)
+}
+
+// sharedRecords returns the records of zone of the served Pods other than old and new, which are
+// the same Pod, that have one of their addresses.
+func (k *KubePods) sharedRecords(zone string, old, new *podRecord) map[string]bool {
+	pod := new
+	if pod == nil {
+		pod = old
+	}
+	var ips []string
+	for _, p := range []*podRecord{old, new} {
+		if p != nil {
+			ips = append(ips, p.allIPs()...)
+		}
+	}
+
+	shared := make(map[string]bool)
+	seen := make(map[*podRecord]bool)
+	for _, ip := range ips {
+		items, err := k.indexer.ByIndex("reverse", ip)
+		if err != nil {
+			continue
+		}
+		for _, item := range items {
+			other, ok := item.(*podRecord)
+			if !ok || seen[other] || (other.Namespace == pod.Namespace && other.Name == pod.Name) {
+				continue
+			}
+			seen[other] = true
+			for _, rr := range k.zoneRecords(zone, other) {
+				shared[rr.String()] = true
+			}
+		}
+	}
+	return shared
+}
+
+// unshared returns the records of rrs that are not in shared.
+func unshared(rrs []dns.RR, shared map[string]bool) (records []dns.RR) {
+	for _, rr := range rrs {
+		if !shared[rr.String()] {
+			records = append(records, rr)
+		}
+	}
+	return records
+}
+
+// diffRecords returns the records only in a, and the records only in b.
+func diffRecords(a, b []dns.RR) (onlyA, onlyB []dns.RR) {
+	inA := make(map[string]bool, len(a))
+	for _, rr := range a {
+		inA[rr.String()] = true
+	}
+	inB := make(map[string]bool, len(b))
+	for _, rr := range b {
+		inB[rr.String()] = true
+	}
+	for _, rr := range a {
+		if !inB[rr.String()] {
+			onlyA = append(onlyA, rr)
+		}
+	}
+	for _, rr := range b {
+		if !inA[rr.String()] {
+			onlyB = append(onlyB, rr)
+		}
+	}
+	return onlyA, onlyB
+}
+
+// record adds a Pod change to the journal and bumps the zone serial. Changes that don't
+// alter any records are ignored.
+func (k *KubePods) record(old, new *podRecord) {
+	if atomic.LoadInt32(&k.synced) == 0 {
+		// the initial list is not a change
+		return
+	}
+	changed := false
+	for _, zone := range k.Zones {
+		deleted, added := k.zoneDiff(zone, old, new)
+		if len(deleted) > 0 || len(added) > 0 {
+			changed = true
+			break
+		}
+		// the preferred Pod of a shared address can change when a Pod terminates
+		if isReverseZone(zone) && old != nil && new != nil && terminated(old) != terminated(new) {
+			changed = true
+			break
+		}
+	}
+	if !changed {
+		return
+	}
+
+	k.journalLock.Lock()
+	k.journal = append(k.journal, change{serial: k.serial, old: old, new: new})
+	if len(k.journal) > journalSize {
+		k.journal = k.journal[len(k.journal)-journalSize:]
+	}
+	k.serial = nextSerial(k.serial)
+	k.journalLock.Unlock()
+
+	select {
+	case k.notifyCh <- struct{}{}:
+	default:
+	}
+}
+
+// nextSerial returns a serial greater than serial, based on the current time if possible.
+func nextSerial(serial uint32) uint32 {
+	if now := uint32(time.Now().Unix()); now > serial {
+		return now
+	}
+	return serial + 1
+}
+
+// waitForSync marks the Pod cache as synced once the initial list has been processed. The event
+// handlers can't ask the controller directly, as they are called while it holds its queue lock.
+// Changes made until then are not journaled, so the serial is bumped to make secondaries do a
+// full transfer.
+func (k *KubePods) waitForSync() {
+	if !cache.WaitForCacheSync(k.stopCh, k.controller.HasSynced) {
+		return
+	}
+	k.journalLock.Lock()
+	atomic.StoreInt32(&k.synced, 1)
+	k.journal = nil
+	k.serial = nextSerial(k.serial)
+	k.journalLock.Unlock()
+	close(k.syncedCh)
+
+	select {
+	case k.notifyCh <- struct{}{}:
+	default:
+	}
+}
+
+// eventHandler returns the handler that tracks Pod changes for incremental zone transfers and metrics.
+func (k *KubePods) eventHandler() cache.ResourceEventHandler {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			podEvents.WithLabelValues("add").Inc()
+			if pod, ok := obj.(*podRecord); ok {
+				k.countPods(1, len(pod.IPs))
+				k.record(nil, pod)
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			podEvents.WithLabelValues("update").Inc()
+			old, ok := oldObj.(*podRecord)
+			if !ok {
+				return
+			}
+			if pod, ok := newObj.(*podRecord); ok {
+				k.countPods(0, len(pod.IPs)-len(old.IPs))
+				k.record(old, pod)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			podEvents.WithLabelValues("delete").Inc()
+			if d, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = d.Obj
+			}
+			if pod, ok := obj.(*podRecord); ok {
+				k.countPods(-1, -len(pod.IPs))
+				k.record(pod, nil)
+			}
+		},
+	}
+}
+
+// notify sends notifies for all zones to the secondaries configured in the transfer plugin,
+// coalescing changes that happen while notifies are being sent.
+func (k *KubePods) notify(t *transfer.Transfer) {
+	for {
+		select {
+		case <-k.stopCh:
+			return
+		case <-k.notifyCh:
+			for _, zone := range k.Zones {
+				if err := t.Notify(zone); err != nil {
+					log.Debugf("Failed sending notifies for zone %q: %s", zone, err)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package kubepods
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/coredns/coredns/plugin/transfer"
+)
+
+func TestTransferNotAuthoritative(t *testing.T) {
+	k := New([]string{"cluster.local."})
+	k.mode = modeName
+
+	if _, err := k.Transfer("example.org.", 0); err != transfer.ErrNotAuthoritative {
+		t.Errorf("Expected %v, got %v", transfer.ErrNotAuthoritative, err)
+	}
+	if _, err := k.Transfer("sub.cluster.local.", 0); err != transfer.ErrNotAuthoritative {
+		t.Errorf("Expected %v, got %v", transfer.ErrNotAuthoritative, err)
+	}
+
+	k.mode = modeEchoIP
+	if _, err := k.Transfer("cluster.local.", 0); err != transfer.ErrNotAuthoritative {
+		t.Errorf("Expected %v, got %v", transfer.ErrNotAuthoritative, err)
+	}
+}
+
+func TestTransfer(t *testing.T) {
+	k := New([]string{"cluster.local.", "in-addr.arpa."})
+	k.mode = modeName
+	k.client = fake.NewSimpleClientset()
+	ctx := context.Background()
+	addFixtures(ctx, k)
+	// a completed Pod that had the address of pod1
+	old1 := &core.Pod{
+		ObjectMeta: meta.ObjectMeta{Name: "old1", Namespace: "namespace2"},
+		Status:     core.PodStatus{Phase: core.PodSucceeded, PodIPs: []core.PodIP{{IP: "1.2.3.4"}}},
+	}
+	k.client.CoreV1().Pods(old1.Namespace).Create(ctx, old1, meta.CreateOptions{})
+
+	k.setWatch(ctx)
+	go k.controller.Run(k.stopCh)
+	defer close(k.stopCh)
+
+	// wait for sync, including the zone serial
+	for atomic.LoadInt32(&k.synced) == 0 {
+		time.Sleep(100 * time.Millisecond)
+	}
+	<-k.notifyCh
+
+	axfr := transferRecords(t, k, "cluster.local.", 0)
+	expect := []string{
+		"cluster.local.	5	IN	NS	ns.dns.cluster.local.",
+		"pod1.namespace1.cluster.local.	5	IN	A	1.2.3.4",
+		"pod1.namespace1.cluster.local.	5	IN	AAAA	5:6:7::8",
+		"_http._tcp.pod1.namespace1.cluster.local.	5	IN	SRV	0 100 80 pod1.namespace1.cluster.local.",
+		"_dns._udp.pod1.namespace1.cluster.local.	5	IN	SRV	0 100 53 pod1.namespace1.cluster.local.",
+		"pod2.namespace2.cluster.local.	5	IN	A	5.6.7.9",
+		"host3.sub3.namespace1.cluster.local.	5	IN	A	10.0.0.3",
+	}
+	checkTransfer(t, axfr, expect)
+
+	rev := transferRecords(t, k, "in-addr.arpa.", 0)
+	checkTransfer(t, rev, []string{
+		"4.3.2.1.in-addr.arpa.	5	IN	PTR	pod1.namespace1.cluster.local.",
+		"3.0.0.10.in-addr.arpa.	5	IN	PTR	host3.sub3.namespace1.cluster.local.",
+	})
+	for _, rr := range rev {
+		if ptr, ok := rr.(*dns.PTR); ok && ptr.Ptr == "old1.namespace2.cluster.local." {
+			t.Errorf("Expected no PTR record of a Pod that isn't preferred for its address, got %v", ptr)
+		}
+	}
+
+	serial := axfr[0].(*dns.SOA).Serial
+
+	// up to date
+	if ixfr := transferRecords(t, k, "cluster.local.", serial); len(ixfr) != 1 {
+		t.Errorf("Expected a single SOA for an up to date IXFR, got %v", ixfr)
+	}
+
+	pod4 := &core.Pod{
+		ObjectMeta: meta.ObjectMeta{Name: "pod4", Namespace: "namespace2"},
+		Status:     core.PodStatus{PodIPs: []core.PodIP{{IP: "10.0.0.4"}}},
+	}
+	k.client.CoreV1().Pods(pod4.Namespace).Create(ctx, pod4, meta.CreateOptions{})
+	for k.soa("cluster.local.").Serial == serial {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	select {
+	case <-k.notifyCh:
+	default:
+		t.Error("Expected a pending notify after a change")
+	}
+
+	ixfr := transferRecords(t, k, "cluster.local.", serial)
+	current := k.soa("cluster.local.").Serial
+	expectSerials := []uint32{current, serial, current, current}
+	var serials []uint32
+	for _, rr := range ixfr {
+		if soa, ok := rr.(*dns.SOA); ok {
+			serials = append(serials, soa.Serial)
+		}
+	}
+	if len(serials) != len(expectSerials) {
+		t.Fatalf("Expected SOA serials %v, got %v", expectSerials, serials)
+	}
+	for i := range serials {
+		if serials[i] != expectSerials[i] {
+			t.Fatalf("Expected SOA serials %v, got %v", expectSerials, serials)
+		}
+	}
+	checkTransfer(t, ixfr, []string{"pod4.namespace2.cluster.local.	5	IN	A	10.0.0.4"})
+	if len(ixfr) != 5 {
+		t.Errorf("Expected 5 records in IXFR, got %d: %v", len(ixfr), ixfr)
+	}
+
+	// reverse zones are always transferred in full
+	if ixfr := transferRecords(t, k, "in-addr.arpa.", serial); len(ixfr) != len(rev)+1 {
+		t.Errorf("Expected AXFR of the reverse zone with %d records, got %d", len(rev)+1, len(ixfr))
+	}
+
+	// unknown serial falls back to AXFR
+	if fallback := transferRecords(t, k, "cluster.local.", serial-1); len(fallback) != len(axfr)+1 {
+		t.Errorf("Expected AXFR fallback with %d records, got %d", len(axfr)+1, len(fallback))
+	}
+}
+
+func TestTransferSharedAddress(t *testing.T) {
+	k := New([]string{"cluster.local."})
+	k.mode = modeIP
+	k.labelKeys["app"] = "app"
+	k.client = fake.NewSimpleClientset()
+	ctx := context.Background()
+	// Pods of DaemonSets on the host network of the same node
+	for _, name := range []string{"agent-a", "agent-b"} {
+		k.client.CoreV1().Pods("kube-system").Create(ctx, &core.Pod{
+			ObjectMeta: meta.ObjectMeta{Name: name, Namespace: "kube-system", Labels: map[string]string{"app": "agent"}},
+			Spec:       core.PodSpec{HostNetwork: true},
+			Status:     core.PodStatus{PodIPs: []core.PodIP{{IP: "172.16.0.1"}}},
+		}, meta.CreateOptions{})
+	}
+
+	k.setWatch(ctx)
+	go k.controller.Run(k.stopCh)
+	defer close(k.stopCh)
+
+	// wait for sync, including the zone serial
+	for atomic.LoadInt32(&k.synced) == 0 {
+		time.Sleep(100 * time.Millisecond)
+	}
+	<-k.notifyCh
+
+	runTests(t, ctx, k, []test.Case{
+		{
+			Qname: "172-16-0-1.kube-system.cluster.local.", Qtype: dns.TypeA,
+			Rcode:  dns.RcodeSuccess,
+			Answer: []dns.RR{test.A("172-16-0-1.kube-system.cluster.local.	5	IN	A	172.16.0.1")},
+		},
+	})
+
+	shared := []string{
+		"172-16-0-1.kube-system.cluster.local.	5	IN	A	172.16.0.1",
+		"agent.app.label.kube-system.cluster.local.	5	IN	A	172.16.0.1",
+	}
+	axfr := transferRecords(t, k, "cluster.local.", 0)
+	checkTransfer(t, axfr, shared)
+	if len(axfr) != 5 {
+		t.Errorf("Expected the shared records once in AXFR, got %v", axfr)
+	}
+
+	// the other Pod still has the records
+	serial := axfr[0].(*dns.SOA).Serial
+	k.client.CoreV1().Pods("kube-system").Delete(ctx, "agent-a", meta.DeleteOptions{})
+	for len(k.indexer.List()) != 1 {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if s := k.soa("cluster.local.").Serial; s != serial {
+		t.Errorf("Expected serial %d to be kept when the records stay in the zone, got %d", serial, s)
+	}
+
+	k.client.CoreV1().Pods("kube-system").Delete(ctx, "agent-b", meta.DeleteOptions{})
+	for k.soa("cluster.local.").Serial == serial {
+		time.Sleep(100 * time.Millisecond)
+	}
+	ixfr := transferRecords(t, k, "cluster.local.", serial)
+	checkTransfer(t, ixfr, shared)
+	if len(ixfr) != 6 {
+		t.Errorf("Expected the deletion of the shared records in IXFR, got %v", ixfr)
+	}
+}
+
+func transferRecords(t *testing.T, k *KubePods, zone string, serial uint32) []dns.RR {
+	ch, err := k.Transfer(zone, serial)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var records []dns.RR
+	for rrs := range ch {
+		records = append(records, rrs...)
+	}
+	if len(records) == 0 {
+		t.Fatal("Empty transfer")
+	}
+	if _, ok := records[0].(*dns.SOA); !ok {
+		t.Errorf("Transfer doesn't start with SOA: %v", records[0])
+	}
+	if _, ok := records[len(records)-1].(*dns.SOA); !ok {
+		t.Errorf("Transfer doesn't end with SOA: %v", records[len(records)-1])
+	}
+	return records
+}
+
+func checkTransfer(t *testing.T, records []dns.RR, expect []string) {
+	got := make(map[string]bool)
+	for _, rr := range records {
+		got[rr.String()] = true
+	}
+	for _, e := range expect {
+		rr, err := dns.NewRR(e)
+		if err != nil {
+			t.Fatalf("Bad test record %q: %v", e, err)
+		}
+		if !got[rr.String()] {
+			t.Errorf("Expected record %q in transfer", rr.String())
+		}
+	}
+}